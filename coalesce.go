@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"singlestore_exporter/collector"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scrapeCachedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("singlestore", "exporter", "scrape_cached"),
+		"Whether the collector metrics of this response were served from the cache of scrape.min_interval",
+		nil,
+		nil,
+	)
+
+	scrapesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "singlestore",
+		Subsystem: "exporter",
+		Name:      "scrapes_total",
+		Help:      "Scrape requests by how they were served: fresh, shared with a concurrent request, or cached",
+	}, []string{"result"})
+)
+
+const (
+	scrapeFresh  = "fresh"
+	scrapeShared = "shared"
+	scrapeCached = "cached"
+)
+
+// scrapeGroup runs at most one scrape at a time per key, e.g. per set of collectors,
+// and hands its result to every request which arrived while it was running.
+// With a minimum interval, the last result is also served until it is older than the interval.
+type scrapeGroup struct {
+	minInterval time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*scrapeEntry
+}
+
+type scrapeEntry struct {
+	// done is closed once metrics is set
+	done     chan struct{}
+	metrics  []prometheus.Metric
+	finished time.Time
+
+	// the scrape is cancelled once the longest deadline of the requests which joined it passed,
+	// or never when one of them has no deadline
+	cancel    context.CancelCauseFunc
+	deadline  time.Time
+	unbounded bool
+	timer     *time.Timer
+}
+
+func newScrapeGroup(minInterval time.Duration) *scrapeGroup {
+	return &scrapeGroup{
+		minInterval: minInterval,
+		entries:     make(map[string]*scrapeEntry),
+	}
+}
+
+// scrape returns the metrics of the collector newCollector makes for key, collecting them only when
+// no scrape of key is running and the last one is older than the minimum interval.
+// The scrape is not cancelled with ctx, since other requests may be waiting for it,
+// but runs until the longest deadline of the requests which joined it.
+// It returns false when ctx is done before the running scrape finished.
+func (g *scrapeGroup) scrape(ctx context.Context, key string, newCollector func(context.Context) prometheus.Collector) ([]prometheus.Metric, string, bool) {
+	g.mu.Lock()
+	g.expire()
+	entry, exists := g.entries[key]
+	if exists {
+		select {
+		case <-entry.done:
+			if time.Since(entry.finished) < g.minInterval {
+				g.mu.Unlock()
+				scrapesTotal.WithLabelValues(scrapeCached).Inc()
+				return entry.metrics, scrapeCached, true
+			}
+		default:
+			entry.extend(ctx)
+			g.mu.Unlock()
+			select {
+			case <-entry.done:
+				scrapesTotal.WithLabelValues(scrapeShared).Inc()
+				return entry.metrics, scrapeShared, true
+			case <-ctx.Done():
+				return nil, scrapeShared, false
+			}
+		}
+	}
+
+	scrapeCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	entry = &scrapeEntry{done: make(chan struct{}), cancel: cancel}
+	entry.extend(ctx)
+	g.entries[key] = entry
+	g.mu.Unlock()
+
+	collector := newCollector(scrapeCtx)
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	metrics := make([]prometheus.Metric, 0)
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+
+	g.mu.Lock()
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	// stops the scrapers abandoned by the collector
+	cancel(context.Canceled)
+	entry.metrics = metrics
+	entry.finished = time.Now()
+	close(entry.done)
+	// without caching, keys such as probe targets must not pile up
+	if g.minInterval <= 0 && g.entries[key] == entry {
+		delete(g.entries, key)
+	}
+	g.mu.Unlock()
+
+	scrapesTotal.WithLabelValues(scrapeFresh).Inc()
+	return metrics, scrapeFresh, true
+}
+
+// expire forgets the finished scrapes whose result is not served any more,
+// so that keys such as probe targets do not pile up. g.mu must be held.
+func (g *scrapeGroup) expire() {
+	for key, entry := range g.entries {
+		select {
+		case <-entry.done:
+			if time.Since(entry.finished) >= g.minInterval {
+				delete(g.entries, key)
+			}
+		default:
+		}
+	}
+}
+
+// extend lets the running scrape run until the deadline of ctx, when it is later than the current one,
+// so that a request which joined it does not fail by the shorter timeout of another. g.mu must be held.
+func (e *scrapeEntry) extend(ctx context.Context) {
+	if e.unbounded {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		e.unbounded = true
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		return
+	}
+	if !deadline.After(e.deadline) {
+		return
+	}
+	e.deadline = deadline
+	if e.timer == nil {
+		cancel := e.cancel
+		e.timer = time.AfterFunc(time.Until(deadline), func() {
+			cancel(context.DeadlineExceeded)
+		})
+		return
+	}
+	e.timer.Reset(time.Until(deadline))
+}
+
+// scrapeKey identifies the scrapes which can be shared, prefix telling e.g. probe targets apart.
+// The order of collect[] does not matter.
+func scrapeKey(prefix string, registrations []collector.Registration) string {
+	names := make([]string, 0, len(registrations))
+	for _, registration := range registrations {
+		names = append(names, registration.Scraper.Name())
+	}
+	sort.Strings(names)
+	return prefix + "/" + strings.Join(names, ",")
+}
+
+// metricsCollector replays collected metrics.
+type metricsCollector struct {
+	metrics []prometheus.Metric
+	result  string
+}
+
+func (c metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector, the metrics depend on the enabled collectors
+}
+
+func (c metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range c.metrics {
+		ch <- metric
+	}
+
+	cached := 0.0
+	if c.result == scrapeCached {
+		cached = 1
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeCachedDesc, prometheus.GaugeValue, cached)
+}
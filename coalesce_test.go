@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"singlestore_exporter/collector"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDesc = prometheus.NewDesc("test_metric", "test metric", nil, nil)
+
+// countingCollector blocks every collection until release is closed
+type countingCollector struct {
+	calls   *atomic.Int32
+	release chan struct{}
+}
+
+func (c countingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- testDesc
+}
+
+func (c countingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.calls.Add(1)
+	<-c.release
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 1)
+}
+
+func (c countingCollector) new(ctx context.Context) prometheus.Collector {
+	return c
+}
+
+// contextCollector collects 1 once release is closed, or 0 when its context is done first
+type contextCollector struct {
+	ctx     context.Context
+	release chan struct{}
+}
+
+func (c contextCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- testDesc
+}
+
+func (c contextCollector) Collect(ch chan<- prometheus.Metric) {
+	value := 1.0
+	select {
+	case <-c.release:
+	case <-c.ctx.Done():
+		value = 0
+	}
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, value)
+}
+
+// namedScraper is a scraper which collects nothing
+type namedScraper string
+
+func (s namedScraper) Name() string {
+	return string(s)
+}
+
+func (s namedScraper) Help() string {
+	return "Collects nothing"
+}
+
+func (s namedScraper) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	return nil
+}
+
+func TestScrapeGroup(t *testing.T) {
+	tt := []struct {
+		name            string
+		minInterval     time.Duration
+		concurrent      int
+		sequential      int
+		expectedCalls   int32
+		expectedResults map[string]int
+	}{
+		{
+			name:            "concurrent scrapes are shared",
+			concurrent:      3,
+			expectedCalls:   1,
+			expectedResults: map[string]int{scrapeFresh: 1, scrapeShared: 2},
+		},
+		{
+			name:            "sequential scrapes without min interval are fresh",
+			sequential:      3,
+			expectedCalls:   3,
+			expectedResults: map[string]int{scrapeFresh: 3},
+		},
+		{
+			name:            "sequential scrapes within min interval are cached",
+			minInterval:     time.Hour,
+			sequential:      3,
+			expectedCalls:   1,
+			expectedResults: map[string]int{scrapeFresh: 1, scrapeCached: 2},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newScrapeGroup(tc.minInterval)
+			calls := &atomic.Int32{}
+			release := make(chan struct{})
+			collector := countingCollector{calls: calls, release: release}
+
+			var mu sync.Mutex
+			results := make(map[string]int)
+			scrape := func() {
+				metrics, result, ok := g.scrape(context.Background(), "key", collector.new)
+				assert.True(t, ok)
+				assert.Len(t, metrics, 1)
+				mu.Lock()
+				results[result]++
+				mu.Unlock()
+			}
+
+			if tc.concurrent > 0 {
+				var wg sync.WaitGroup
+				wg.Add(tc.concurrent)
+				for i := 0; i < tc.concurrent; i++ {
+					go func() {
+						defer wg.Done()
+						scrape()
+					}()
+				}
+				// let every request join the running scrape before it finishes
+				assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+				time.Sleep(50 * time.Millisecond)
+				close(release)
+				wg.Wait()
+			} else {
+				close(release)
+				for i := 0; i < tc.sequential; i++ {
+					scrape()
+				}
+			}
+
+			assert.Equal(t, tc.expectedCalls, calls.Load())
+			assert.Equal(t, tc.expectedResults, results)
+		})
+	}
+}
+
+func TestScrapeGroupWaiterTimeout(t *testing.T) {
+	g := newScrapeGroup(0)
+	release := make(chan struct{})
+	collector := countingCollector{calls: &atomic.Int32{}, release: release}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.scrape(context.Background(), "key", collector.new)
+	}()
+	assert.Eventually(t, func() bool { return collector.calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, ok := g.scrape(ctx, "key", collector.new)
+	assert.False(t, ok)
+
+	close(release)
+	<-done
+}
+
+func TestScrapeGroupLongestDeadline(t *testing.T) {
+	g := newScrapeGroup(0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	newCollector := func(ctx context.Context) prometheus.Collector {
+		close(started)
+		return contextCollector{ctx: ctx, release: release}
+	}
+
+	shortCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	longCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	results := make(chan float64, 2)
+	scrape := func(ctx context.Context) {
+		metrics, _, ok := g.scrape(ctx, "key", newCollector)
+		if !ok || len(metrics) != 1 {
+			results <- -1
+			return
+		}
+		m := &dto.Metric{}
+		if err := metrics[0].Write(m); err != nil {
+			t.Error(err)
+		}
+		results <- m.GetGauge().GetValue()
+	}
+	go scrape(shortCtx)
+	<-started
+	go scrape(longCtx)
+
+	// the shared scrape outlives the deadline of the request which started it
+	<-shortCtx.Done()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.Equal(t, 1.0, <-results)
+	assert.Equal(t, 1.0, <-results)
+}
+
+func TestScrapeGroupExpiry(t *testing.T) {
+	g := newScrapeGroup(10 * time.Millisecond)
+	release := make(chan struct{})
+	close(release)
+	collector := countingCollector{calls: &atomic.Int32{}, release: release}
+
+	g.scrape(context.Background(), "probe:a", collector.new)
+	time.Sleep(20 * time.Millisecond)
+	g.scrape(context.Background(), "probe:b", collector.new)
+
+	// the result of a is older than the min interval, and forgotten
+	assert.Len(t, g.entries, 1)
+	assert.Contains(t, g.entries, "probe:b")
+}
+
+func TestScrapeKey(t *testing.T) {
+	registration := func(name string) collector.Registration {
+		return collector.Registration{Scraper: namedScraper(name)}
+	}
+	assert.Equal(t,
+		scrapeKey("metrics", []collector.Registration{registration("nodes"), registration("activities")}),
+		scrapeKey("metrics", []collector.Registration{registration("activities"), registration("nodes")}),
+	)
+}
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus"
 	"singlestore_exporter/log"
@@ -63,26 +64,29 @@ var (
 
 type ScrapeActiveTransactions struct{}
 
+func (s *ScrapeActiveTransactions) Name() string {
+	return "active_transaction"
+}
+
 func (s *ScrapeActiveTransactions) Help() string {
 	return "Collect active transactions"
 }
 
-func (s *ScrapeActiveTransactions) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) {
+func (s *ScrapeActiveTransactions) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
 	if db == nil {
-		return
+		return errNoConnection
 	}
 
 	views := make([]ActiveDistributedTransactionsView, 0)
 	if err := db.SelectContext(ctx, &views, infoSchemaActiveDistributedTransactionsViewExistsQuery); err != nil {
 		log.ErrorLogger.Errorf("checking existence view query failed: query=%s error=%v", infoSchemaActiveDistributedTransactionsViewExistsQuery, err)
 	} else if len(views) == 0 {
-		return
+		return nil
 	}
 
 	activeTransactionList := make([]ActiveDistributedTransactions, 0)
-	if err := db.Select(&activeTransactionList, infoSchemaActiveDistributedTransactionsQuery); err != nil {
-		log.ErrorLogger.Errorf("scraping query failed: query=%s error=%v", infoSchemaActiveDistributedTransactionsQuery, err)
-		return
+	if err := db.SelectContext(ctx, &activeTransactionList, infoSchemaActiveDistributedTransactionsQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaActiveDistributedTransactionsQuery, err)
 	}
 
 	for i := range activeTransactionList {
@@ -112,4 +116,6 @@ func (s *ScrapeActiveTransactions) Scrape(ctx context.Context, db *sqlx.DB, ch c
 			activeTransaction.PartitionName,
 		)
 	}
+
+	return nil
 }
@@ -0,0 +1,372 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ActivityRow is the cumulative resource usage of an activity on a partition of a node.
+type ActivityRow struct {
+	NodeID       int64  `db:"NODE_ID"`
+	PartitionID  int64  `db:"PARTITION_ID"`
+	DatabaseName string `db:"DATABASE_NAME"`
+	ActivityType string `db:"ACTIVITY_TYPE"`
+	ActivityName string `db:"ACTIVITY_NAME"`
+	// QueryName is the activity name of the aggregator, shared by the leaf activities of a query
+	QueryName           string  `db:"QUERY_NAME"`
+	CPUTimeMS           float64 `db:"CPU_TIME_MS"`
+	CPUWaitTimeMS       float64 `db:"CPU_WAIT_TIME_MS"`
+	DiskPhysicalReadB   float64 `db:"DISK_PHYSICAL_READ_B"`
+	DiskPhysicalWriteB  float64 `db:"DISK_PHYSICAL_WRITE_B"`
+	NetworkLogicalRecvB float64 `db:"NETWORK_LOGICAL_RECV_B"`
+	NetworkLogicalSendB float64 `db:"NETWORK_LOGICAL_SEND_B"`
+	LockTimeMS          float64 `db:"LOCK_TIME_MS"`
+	LockRowTimeMS       float64 `db:"LOCK_ROW_TIME_MS"`
+	MemoryBS            float64 `db:"MEMORY_BS"`
+	RunCount            float64 `db:"RUN_COUNT"`
+}
+
+type NodeUptime struct {
+	ID     int64 `db:"ID"`
+	Uptime int64 `db:"UPTIME"`
+}
+
+const (
+	activity = "activity"
+
+	numActivityValues = 10
+
+	// activityOtherQuery is the query label of the queries beyond the top queries
+	activityOtherQuery = "other"
+
+	// activityQueryIdleTimeout is how long a top query keeps its label without using any CPU
+	activityQueryIdleTimeout = 15 * time.Minute
+
+	infoSchemaActivitiesQuery = `SELECT
+    NODE_ID,
+    NVL(PARTITION_ID, -1) AS PARTITION_ID,
+    NVL(DATABASE_NAME, '') AS DATABASE_NAME,
+    ACTIVITY_TYPE,
+    ACTIVITY_NAME,
+    NVL(AGGREGATOR_ACTIVITY_NAME, ACTIVITY_NAME) AS QUERY_NAME,
+    NVL(SUM(CPU_TIME_MS), 0) AS CPU_TIME_MS,
+    NVL(SUM(CPU_WAIT_TIME_MS), 0) AS CPU_WAIT_TIME_MS,
+    NVL(SUM(DISK_PHYSICAL_READ_B), 0) AS DISK_PHYSICAL_READ_B,
+    NVL(SUM(DISK_PHYSICAL_WRITE_B), 0) AS DISK_PHYSICAL_WRITE_B,
+    NVL(SUM(NETWORK_LOGICAL_RECV_B), 0) AS NETWORK_LOGICAL_RECV_B,
+    NVL(SUM(NETWORK_LOGICAL_SEND_B), 0) AS NETWORK_LOGICAL_SEND_B,
+    NVL(SUM(LOCK_TIME_MS), 0) AS LOCK_TIME_MS,
+    NVL(SUM(LOCK_ROW_TIME_MS), 0) AS LOCK_ROW_TIME_MS,
+    NVL(SUM(MEMORY_BS), 0) AS MEMORY_BS,
+    NVL(SUM(RUN_COUNT), 0) AS RUN_COUNT
+FROM information_schema.MV_ACTIVITIES_EXTENDED_CUMULATIVE
+GROUP BY NODE_ID, PARTITION_ID, DATABASE_NAME, ACTIVITY_TYPE, ACTIVITY_NAME, AGGREGATOR_ACTIVITY_NAME`
+
+	infoSchemaNodeUptimesQuery = `SELECT ID, UPTIME FROM information_schema.MV_NODES`
+)
+
+// activityValues holds one value per desc of activityDescs
+type activityValues [numActivityValues]float64
+
+var (
+	activityLabels = []string{"database", "activity_type", "query"}
+
+	activityDescs = [numActivityValues]*prometheus.Desc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "cpu_time_seconds_total"),
+			"CPU time spent by activities",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "cpu_wait_time_seconds_total"),
+			"Time activities waited for a CPU",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "disk_read_bytes_total"),
+			"Bytes read from disk by activities",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "disk_write_bytes_total"),
+			"Bytes written to disk by activities",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "network_receive_bytes_total"),
+			"Bytes received over the network by activities",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "network_send_bytes_total"),
+			"Bytes sent over the network by activities",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "lock_wait_seconds_total"),
+			"Time activities waited for locks",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "row_lock_wait_seconds_total"),
+			"Time activities waited for row locks",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "memory_byte_seconds_total"),
+			"Memory used by activities, integrated over time",
+			activityLabels, nil,
+		),
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, activity, "runs_total"),
+			"Number of runs of activities",
+			activityLabels, nil,
+		),
+	}
+)
+
+func (r *ActivityRow) values() activityValues {
+	return activityValues{
+		r.CPUTimeMS / 1000,
+		r.CPUWaitTimeMS / 1000,
+		r.DiskPhysicalReadB,
+		r.DiskPhysicalWriteB,
+		r.NetworkLogicalRecvB,
+		r.NetworkLogicalSendB,
+		r.LockTimeMS / 1000,
+		r.LockRowTimeMS / 1000,
+		r.MemoryBS,
+		r.RunCount,
+	}
+}
+
+type activityKey struct {
+	nodeID       int64
+	partitionID  int64
+	databaseName string
+	activityType string
+	activityName string
+	queryName    string
+}
+
+type activitySeries struct {
+	databaseName string
+	activityType string
+	queryName    string
+}
+
+// activityState turns the cumulative values of one cluster, which are lost when a node restarts
+// or an activity is evicted, into counters which only go up.
+type activityState struct {
+	initialized bool
+
+	previous map[activityKey]activityValues
+	uptimes  map[int64]int64
+	// queries are the top queries with their own query label, by the last time they used CPU.
+	// They keep it while they are active, so that their series stay stable, and give it up when idle.
+	queries map[string]time.Time
+	totals  map[activitySeries]*activityValues
+}
+
+func newActivityState() *activityState {
+	return &activityState{
+		previous: make(map[activityKey]activityValues),
+		uptimes:  make(map[int64]int64),
+		queries:  make(map[string]time.Time),
+		totals:   make(map[activitySeries]*activityValues),
+	}
+}
+
+// update adds the usage since the last update to the counters. The first update only takes the baseline,
+// so that restarting the exporter is seen as a counter reset instead of a jump by the whole history.
+func (s *activityState) update(rows []ActivityRow, uptimes []NodeUptime, topQueries int, now time.Time) {
+	restarted := make(map[int64]bool)
+	currentUptimes := make(map[int64]int64, len(uptimes))
+	for _, node := range uptimes {
+		if previous, exists := s.uptimes[node.ID]; exists && node.Uptime < previous {
+			restarted[node.ID] = true
+		}
+		currentUptimes[node.ID] = node.Uptime
+	}
+
+	current := make(map[activityKey]activityValues, len(rows))
+	deltas := make([]activityValues, len(rows))
+	// weights rank the queries without a label of their own, by CPU time
+	weights := make(map[string]float64)
+	for i, row := range rows {
+		key := activityKey{row.NodeID, row.PartitionID, row.DatabaseName, row.ActivityType, row.ActivityName, row.QueryName}
+		values := row.values()
+		current[key] = values
+
+		if !s.initialized {
+			// nothing is counted yet, the initial top queries are those which used the most CPU so far
+			weights[row.QueryName] += values[0]
+			continue
+		}
+
+		// usage of an activity seen for the first time, or since its node restarted, counts in full
+		delta := values
+		if previous, exists := s.previous[key]; exists && !restarted[row.NodeID] && !decreased(previous[:], values[:]) {
+			for j := range delta {
+				delta[j] -= previous[j]
+			}
+		}
+		deltas[i] = delta
+		weights[row.QueryName] += delta[0]
+	}
+
+	s.releaseQueries(weights, topQueries, now)
+	s.admitQueries(weights, topQueries, now)
+
+	for i, row := range rows {
+		series := activitySeries{row.DatabaseName, row.ActivityType, activityOtherQuery}
+		if _, exists := s.queries[row.QueryName]; exists {
+			series.queryName = row.QueryName
+		}
+		totals, exists := s.totals[series]
+		if !exists {
+			totals = &activityValues{}
+			s.totals[series] = totals
+		}
+		for j := range totals {
+			totals[j] += deltas[i][j]
+		}
+	}
+
+	s.previous = current
+	s.uptimes = currentUptimes
+	s.initialized = true
+}
+
+// releaseQueries takes the label of the top queries which have been idle for activityQueryIdleTimeout,
+// and of the least recently active ones beyond topQueries, e.g. after it was lowered by a reload.
+// Their series are dropped, later usage counts as "other".
+func (s *activityState) releaseQueries(weights map[string]float64, topQueries int, now time.Time) {
+	queries := make([]string, 0, len(s.queries))
+	for name := range s.queries {
+		if weights[name] > 0 {
+			s.queries[name] = now
+		}
+		queries = append(queries, name)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		if !s.queries[queries[i]].Equal(s.queries[queries[j]]) {
+			return s.queries[queries[i]].After(s.queries[queries[j]])
+		}
+		return queries[i] < queries[j]
+	})
+
+	for i, name := range queries {
+		if i < topQueries && now.Sub(s.queries[name]) < activityQueryIdleTimeout {
+			continue
+		}
+		delete(s.queries, name)
+		for series := range s.totals {
+			if series.queryName == name {
+				delete(s.totals, series)
+			}
+		}
+	}
+}
+
+// admitQueries gives the heaviest queries without a label of their own one, while fewer than topQueries have one.
+func (s *activityState) admitQueries(weights map[string]float64, topQueries int, now time.Time) {
+	candidates := make([]string, 0)
+	for name, weight := range weights {
+		if _, exists := s.queries[name]; !exists && weight > 0 {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if weights[candidates[i]] != weights[candidates[j]] {
+			return weights[candidates[i]] > weights[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	for _, name := range candidates {
+		if len(s.queries) >= topQueries {
+			return
+		}
+		s.queries[name] = now
+	}
+}
+
+func (s *activityState) metrics() []prometheus.Metric {
+	metrics := make([]prometheus.Metric, 0, len(s.totals)*len(activityDescs))
+	for series, totals := range s.totals {
+		for i, desc := range activityDescs {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				desc, prometheus.CounterValue, totals[i],
+				series.databaseName,
+				series.activityType,
+				series.queryName,
+			))
+		}
+	}
+	return metrics
+}
+
+// decreased tells whether any cumulative value went down, i.e. was reset
+func decreased(previous, current []float64) bool {
+	for i := range current {
+		if current[i] < previous[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrapeActivities exports the resource usage of activities as counters.
+// MV_ACTIVITIES_EXTENDED_CUMULATIVE is reset when a node restarts and forgets evicted activities,
+// so the counters are kept by the exporter, one set per target, in ScraperStates which outlive reloads.
+type ScrapeActivities struct {
+	// TopQueries is the number of queries with their own query label, the others are summed up as "other"
+	TopQueries int
+
+	states *targetStates[activityState]
+}
+
+func NewScrapeActivities(topQueries int, states *ScraperStates) *ScrapeActivities {
+	return &ScrapeActivities{
+		TopQueries: topQueries,
+		states:     states.activities,
+	}
+}
+
+func (s *ScrapeActivities) Name() string {
+	return "activities"
+}
+
+func (s *ScrapeActivities) Help() string {
+	return "Collect resource usage from information_schema.MV_ACTIVITIES_EXTENDED_CUMULATIVE"
+}
+
+func (s *ScrapeActivities) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if db == nil {
+		return errNoConnection
+	}
+
+	rows := make([]ActivityRow, 0)
+	if err := db.SelectContext(ctx, &rows, infoSchemaActivitiesQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaActivitiesQuery, err)
+	}
+	uptimes := make([]NodeUptime, 0)
+	if err := db.SelectContext(ctx, &uptimes, infoSchemaNodeUptimesQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaNodeUptimesQuery, err)
+	}
+
+	metrics := s.states.update(ctx, func(state *activityState) []prometheus.Metric {
+		state.update(rows, uptimes, s.TopQueries, time.Now())
+		return state.metrics()
+	})
+	for _, metric := range metrics {
+		ch <- metric
+	}
+	return nil
+}
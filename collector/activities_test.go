@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivityState(t *testing.T) {
+	row := func(nodeID int64, query string, cpuMS float64) ActivityRow {
+		return ActivityRow{NodeID: nodeID, DatabaseName: "db", ActivityType: "Query", ActivityName: query, QueryName: query, CPUTimeMS: cpuMS}
+	}
+	uptime := func(seconds int64) []NodeUptime {
+		return []NodeUptime{{ID: 1, Uptime: seconds}, {ID: 2, Uptime: 1000}}
+	}
+	cpu := func(s *activityState, query string) float64 {
+		totals, exists := s.totals[activitySeries{"db", "Query", query}]
+		if !exists {
+			return -1
+		}
+		return totals[0]
+	}
+
+	tt := []struct {
+		name       string
+		topQueries int
+		scrapes    [][]ActivityRow
+		uptimes    [][]NodeUptime
+		// interval between the scrapes, 15s when zero
+		interval time.Duration
+		expected map[string]float64
+	}{
+		{
+			name:       "the first scrape is the baseline",
+			topQueries: 10,
+			scrapes: [][]ActivityRow{
+				{row(1, "a", 5000), row(2, "a", 1000)},
+				{row(1, "a", 6000), row(2, "a", 3000)},
+			},
+			uptimes:  [][]NodeUptime{uptime(100), uptime(110)},
+			expected: map[string]float64{"a": 3},
+		},
+		{
+			name:       "new activities count in full",
+			topQueries: 10,
+			scrapes: [][]ActivityRow{
+				{row(1, "a", 5000)},
+				{row(1, "a", 5000), row(1, "b", 2000)},
+			},
+			uptimes:  [][]NodeUptime{uptime(100), uptime(110)},
+			expected: map[string]float64{"a": 0, "b": 2},
+		},
+		{
+			name:       "restarted nodes count in full",
+			topQueries: 10,
+			scrapes: [][]ActivityRow{
+				{row(1, "a", 5000), row(2, "a", 1000)},
+				// node 1 restarted and already used more than before
+				{row(1, "a", 7000), row(2, "a", 1000)},
+			},
+			uptimes:  [][]NodeUptime{uptime(100), uptime(10)},
+			expected: map[string]float64{"a": 7},
+		},
+		{
+			name:       "decreasing values are a reset",
+			topQueries: 10,
+			scrapes: [][]ActivityRow{
+				{row(1, "a", 5000)},
+				{row(1, "a", 1000)},
+				{row(1, "a", 1500)},
+			},
+			uptimes:  [][]NodeUptime{uptime(100), uptime(110), uptime(120)},
+			expected: map[string]float64{"a": 1.5},
+		},
+		{
+			name:       "evicted activities do not decrease counters",
+			topQueries: 10,
+			scrapes: [][]ActivityRow{
+				{row(1, "a", 5000)},
+				{row(1, "a", 6000)},
+				{},
+			},
+			uptimes:  [][]NodeUptime{uptime(100), uptime(110), uptime(120)},
+			expected: map[string]float64{"a": 1},
+		},
+		{
+			name:       "queries beyond the top queries are other",
+			topQueries: 1,
+			scrapes: [][]ActivityRow{
+				{row(1, "a", 1000), row(1, "b", 5000)},
+				{row(1, "a", 9000), row(1, "b", 6000), row(1, "c", 1000)},
+			},
+			uptimes: [][]NodeUptime{uptime(100), uptime(110)},
+			// b used the most CPU before the exporter started, and keeps its label
+			expected: map[string]float64{"a": -1, "b": 1, "other": 9},
+		},
+		{
+			name:       "idle queries give up their label",
+			topQueries: 1,
+			scrapes: [][]ActivityRow{
+				{row(1, "a", 1000), row(1, "b", 5000)},
+				{row(1, "a", 2000), row(1, "b", 5000)},
+				// b has been idle for 20 minutes, a takes its label
+				{row(1, "a", 4000), row(1, "b", 5000)},
+			},
+			uptimes:  [][]NodeUptime{uptime(100), uptime(700), uptime(1300)},
+			interval: 10 * time.Minute,
+			expected: map[string]float64{"a": 2, "b": -1, "other": 1},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			interval := tc.interval
+			if interval == 0 {
+				interval = 15 * time.Second
+			}
+			s := newActivityState()
+			now := time.Now()
+			for i, rows := range tc.scrapes {
+				s.update(rows, tc.uptimes[i], tc.topQueries, now.Add(time.Duration(i)*interval))
+			}
+			for query, expected := range tc.expected {
+				assert.InDelta(t, expected, cpu(s, query), 1e-9, query)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"singlestore_exporter/log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	background = "background"
+)
+
+var (
+	backgroundLastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, background+"_last_success_timestamp_seconds"),
+		"Timestamp of the last successful background run of a collector",
+		[]string{"collector"},
+		nil,
+	)
+
+	backgroundCacheAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, background+"_cache_age_seconds"),
+		"Age of the cached result of a background collector",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+// cachingScraper keeps the result of its runs itself, e.g. per node, and tells at serve time how old it is.
+// BackgroundScraper refreshes it on its interval and serves it on every scrape, instead of caching its metrics.
+type cachingScraper interface {
+	Refresh(ctx context.Context, db *sqlx.DB) error
+	// Refreshed tells whether the cache holds a result, which may be from before a reload
+	Refreshed() bool
+	Serve(ch chan<- prometheus.Metric)
+}
+
+// BackgroundScraper runs a scraper on its own interval, off the scrape path,
+// and serves the metrics of its last successful run on every scrape.
+type BackgroundScraper struct {
+	registration Registration
+	interval     time.Duration
+	pool         *DBPool
+
+	mu          sync.Mutex
+	metrics     []prometheus.Metric
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// NewBackgroundScraper wraps the scraper of registration. pool is nil when no DSN is configured.
+func NewBackgroundScraper(registration Registration, interval time.Duration, pool *DBPool) *BackgroundScraper {
+	return &BackgroundScraper{
+		registration: registration,
+		interval:     interval,
+		pool:         pool,
+	}
+}
+
+func (b *BackgroundScraper) Name() string {
+	return b.registration.Scraper.Name()
+}
+
+func (b *BackgroundScraper) Help() string {
+	return b.registration.Scraper.Help()
+}
+
+// Run scrapes right away and then on every interval, until ctx is cancelled.
+func (b *BackgroundScraper) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		b.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *BackgroundScraper) run(ctx context.Context) {
+	// a run must not overlap with the next one
+	timeout := b.registration.Timeout
+	if timeout <= 0 || timeout > b.interval {
+		timeout = b.interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var db *sqlx.DB
+	if b.pool != nil {
+		ctx = withTargetKey(ctx, b.pool.redactedDSN)
+	}
+	// collectors which only use memsqlctl, e.g. data_disk_usage, must not ping a down aggregator on every run
+	if b.pool != nil && b.registration.RequiresDSN {
+		var err error
+		if db, err = b.pool.DB(ctx); err != nil {
+			log.ErrorLogger.Errorf("db conn failed: collector=%s err=%v", b.Name(), err)
+		}
+	}
+
+	// unlike scrapes, a background run is not abandoned on timeout but waited for,
+	// so that its child processes are reaped when the exporter is stopped
+	var metrics []prometheus.Metric
+	var err error
+	if caching, ok := b.registration.Scraper.(cachingScraper); ok {
+		err = caching.Refresh(ctx, db)
+	} else {
+		metrics, err = collectMetrics(ctx, b.registration.Scraper, db)
+	}
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// stopped by a reload or on shutdown
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastErr = err
+	if err != nil {
+		log.ErrorLogger.Errorf("background scraper failed: collector=%s error=%v", b.Name(), err)
+		countScrapeError(ctx, b.Name())
+		return
+	}
+	b.metrics = metrics
+	b.lastSuccess = time.Now()
+}
+
+func collectMetrics(ctx context.Context, scraper Scraper, db *sqlx.DB) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	metrics := make([]prometheus.Metric, 0)
+	go func() {
+		defer close(done)
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+	}()
+
+	err := scraper.Scrape(ctx, db, ch)
+	close(ch)
+	<-done
+	return metrics, err
+}
+
+// Scrape serves the cached metrics. The last good result is kept when a background run fails,
+// but the error is returned to mark the collector as failed.
+func (b *BackgroundScraper) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	caching, isCaching := b.registration.Scraper.(cachingScraper)
+	if isCaching {
+		// its cache may outlive this BackgroundScraper, and is served before the first run after a reload
+		caching.Serve(ch)
+	}
+
+	if b.lastSuccess.IsZero() {
+		if b.lastErr != nil {
+			return fmt.Errorf("no successful background run yet: %v", b.lastErr)
+		}
+		if isCaching && caching.Refreshed() {
+			return nil
+		}
+		return fmt.Errorf("no successful background run yet")
+	}
+
+	for _, metric := range b.metrics {
+		ch <- metric
+	}
+	ch <- prometheus.MustNewConstMetric(
+		backgroundLastSuccessDesc, prometheus.GaugeValue, float64(b.lastSuccess.UnixNano())/1e9,
+		b.Name(),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		backgroundCacheAgeDesc, prometheus.GaugeValue, time.Since(b.lastSuccess).Seconds(),
+		b.Name(),
+	)
+
+	if b.lastErr != nil {
+		return fmt.Errorf("last background run failed, serving the result of %s: %v", b.lastSuccess.Format(time.RFC3339), b.lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyScraper struct {
+	err error
+}
+
+func (s *flakyScraper) Name() string {
+	return "flaky"
+}
+
+func (s *flakyScraper) Help() string {
+	return "Fails when err is set"
+}
+
+func (s *flakyScraper) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if s.err != nil {
+		return s.err
+	}
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 1)
+	return nil
+}
+
+func scrapeAll(scraper Scraper) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric, 10)
+	err := scraper.Scrape(context.Background(), nil, ch)
+	close(ch)
+
+	metrics := make([]prometheus.Metric, 0)
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics, err
+}
+
+// drain closes ch and returns the metrics sent to it
+func drain(ch chan prometheus.Metric) []prometheus.Metric {
+	close(ch)
+	metrics := make([]prometheus.Metric, 0)
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// metricValues returns the values of metrics keyed by their desc and labels,
+// e.g. Desc{...},node_id=1 for comparing whole scrapes
+func metricValues(t *testing.T, metrics []prometheus.Metric) map[string]float64 {
+	values := make(map[string]float64, len(metrics))
+	for _, metric := range metrics {
+		m := &dto.Metric{}
+		assert.NoError(t, metric.Write(m))
+		key := metric.Desc().String()
+		for _, label := range m.GetLabel() {
+			key += "," + label.GetName() + "=" + label.GetValue()
+		}
+		switch {
+		case m.Counter != nil:
+			values[key] = m.GetCounter().GetValue()
+		case m.Untyped != nil:
+			values[key] = m.GetUntyped().GetValue()
+		default:
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestBackgroundScraper(t *testing.T) {
+	flaky := &flakyScraper{err: errors.New("not yet")}
+	scraper := NewBackgroundScraper(Registration{Scraper: flaky}, time.Minute, nil)
+	errorsTotal := func() float64 {
+		return metricValues(t, scrapeErrorsMetrics(context.Background()))[scrapeErrorsTotalDesc.String()+",collector=flaky"]
+	}
+	errors0 := errorsTotal()
+
+	// nothing to serve before the first successful run
+	scraper.run(context.Background())
+	metrics, err := scrapeAll(scraper)
+	assert.Error(t, err)
+	assert.Empty(t, metrics)
+
+	// cached metrics, last success timestamp and cache age
+	flaky.err = nil
+	scraper.run(context.Background())
+	metrics, err = scrapeAll(scraper)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 3)
+
+	// the last good result is still served after a failed run
+	flaky.err = errors.New("broken")
+	scraper.run(context.Background())
+	metrics, err = scrapeAll(scraper)
+	assert.Error(t, err)
+	assert.Len(t, metrics, 3)
+
+	// errors are counted by the failed runs, not by every scrape serving them
+	exporter := New(context.Background(), "test", nil, []Registration{{Scraper: scraper}})
+	for i := 0; i < 3; i++ {
+		ch := make(chan prometheus.Metric, 10)
+		exporter.scrape(ch)
+		drain(ch)
+	}
+	assert.Equal(t, errors0+2, errorsTotal())
+}
+
+func TestBackgroundScraperWithoutDSN(t *testing.T) {
+	// the aggregator is down, which a collector only using memsqlctl does not care about
+	connector := &fakeConnector{down: true}
+	pool := newTestDBPool(connector)
+
+	scraper := NewBackgroundScraper(Registration{Scraper: &flakyScraper{}}, time.Minute, pool)
+	scraper.run(context.Background())
+	_, err := scrapeAll(scraper)
+	assert.NoError(t, err)
+	assert.Zero(t, connector.connects)
+	assert.Zero(t, pool.backoff)
+
+	scraper = NewBackgroundScraper(Registration{Scraper: &flakyScraper{}, RequiresDSN: true}, time.Minute, pool)
+	scraper.run(context.Background())
+	assert.Equal(t, 1, connector.connects)
+}
@@ -2,7 +2,7 @@ package collector
 
 import (
 	"context"
-	"singlestore_exporter/log"
+	"fmt"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus"
@@ -44,19 +44,22 @@ var (
 
 type ScrapeCachedBlobs struct{}
 
+func (s *ScrapeCachedBlobs) Name() string {
+	return "cached_blobs"
+}
+
 func (s *ScrapeCachedBlobs) Help() string {
 	return "Collect metrics from information_schema.MV_CACHED_BLOBS"
 }
 
-func (s *ScrapeCachedBlobs) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) {
+func (s *ScrapeCachedBlobs) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
 	if db == nil {
-		return
+		return errNoConnection
 	}
 
 	rows := make([]CachedBlobs, 0)
 	if err := db.SelectContext(ctx, &rows, infoSchemaCachedBlobQuery); err != nil {
-		log.ErrorLogger.Errorf("scraping query failed: query=%s error=%v", infoSchemaCachedBlobQuery, err)
-		return
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaCachedBlobQuery, err)
 	}
 
 	for _, row := range rows {
@@ -75,4 +78,6 @@ func (s *ScrapeCachedBlobs) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- p
 			row.Type,
 		)
 	}
+
+	return nil
 }
@@ -2,32 +2,16 @@ package collector
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus"
-	"os/exec"
 	"singlestore_exporter/log"
+	"singlestore_exporter/memsqlctl"
 	"singlestore_exporter/util"
 	"sync"
+	"time"
 )
 
-type MemsqlNode struct {
-	MemsqlId          string `json:"memsqlId"`
-	Role              string `json:"role"`
-	Port              int    `json:"port"`
-	ProcessState      string `json:"processState"`
-	IsConnectable     bool   `json:"isConnectable"`
-	Version           string `json:"version"`
-	RecoveryState     string `json:"recoveryState"`
-	AvailabilityGroup int    `json:"availabilityGroup"`
-	BindAddress       string `json:"bindAddress"`
-	NodeID            string `json:"nodeID"`
-}
-
-type MemsqlNodes struct {
-	Nodes []MemsqlNode `json:"nodes"`
-}
-
 type DataDiskUsage struct {
 	NodeID        string `json:"NODE_ID"`
 	DatabaseName  string `json:"DATABASE_NAME"`
@@ -39,62 +23,6 @@ type DataDiskUsage struct {
 	TempBlobsByte string `json:"TEMP_BLOBS_B"`
 }
 
-type DataDiskUsageRows struct {
-	Rows []DataDiskUsage `json:"rows"`
-}
-
-var (
-	dataDiskUsagesMu sync.Mutex
-	dataDiskUsages   []DataDiskUsage
-)
-
-func ScrapeDataDiskUsages() {
-	var totalRows []DataDiskUsage
-	var err error
-
-	defer func() {
-		dataDiskUsagesMu.Lock()
-		defer dataDiskUsagesMu.Unlock()
-
-		if err != nil {
-			dataDiskUsages = nil
-		} else {
-			dataDiskUsages = totalRows
-		}
-	}()
-
-	// get memsql nodes first
-	var out []byte
-	out, err = exec.Command("/usr/bin/memsqlctl", "list-nodes", "--json").Output()
-	if err != nil {
-		log.ErrorLogger.Errorf("scraping command failed: command='memsqlctl list-nodes --json' out=%s error=%v", string(out), err)
-		return
-	}
-
-	var memsqlNodes MemsqlNodes
-	if err = json.Unmarshal(out, &memsqlNodes); err != nil {
-		log.ErrorLogger.Errorf("unmarshal output failed: command='memsqlctl list-nodes --json' out=%s error=%v", string(out), err)
-		return
-	}
-
-	// get data disk usage per node
-	for _, node := range memsqlNodes.Nodes {
-		out, err = exec.Command("/usr/bin/memsqlctl", "query", "--memsql-id", node.MemsqlId, "--sql", infoSchemaDataDiskUsageQuery, "--json").Output()
-		if err != nil {
-			log.ErrorLogger.Errorf("scraping command failed: command='memsqlctl query --sql '%s' --json' out=%s error=%v", infoSchemaDataDiskUsageQuery, string(out), err)
-			return
-		}
-
-		var rows DataDiskUsageRows
-		if err = json.Unmarshal(out, &rows); err != nil {
-			log.ErrorLogger.Errorf("unmarshal output failed: command='memsqlctl query --sql '%s' --json' out=%s error=%v", infoSchemaDataDiskUsageQuery, string(out), err)
-			return
-		}
-
-		totalRows = append(totalRows, rows.Rows...)
-	}
-}
-
 const (
 	dataDiskUsage = "data_disk_usage"
 
@@ -136,58 +64,255 @@ var (
 		[]string{"node_id", "database_name", "ordinal"},
 		nil,
 	)
+
+	dataDiskUsageStalenessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, dataDiskUsage, "staleness_seconds"),
+		"seconds since the data disk usage of the node was last collected successfully",
+		[]string{"memsql_id"},
+		nil,
+	)
+
+	dataDiskUsageNodeSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, dataDiskUsage, "node_success"),
+		"Whether the last query of the data disk usage of the node succeeded",
+		[]string{"memsql_id"},
+		nil,
+	)
 )
 
-type ScrapeDataDiskUsage struct{}
+// nodeDataDiskUsage is the last successful result of a node, and whether its last query failed.
+// A node which never succeeded has no rows and a zero lastSuccess.
+type nodeDataDiskUsage struct {
+	rows        []DataDiskUsage
+	lastSuccess time.Time
+	failed      bool
+}
+
+// dataDiskUsageCache holds the last successful result of every node. It is kept in ScraperStates,
+// so that the results survive reloads.
+type dataDiskUsageCache struct {
+	mu    sync.Mutex
+	nodes map[string]*nodeDataDiskUsage
+	// refreshed is set once a refresh succeeded, before which the cache is not a result
+	refreshed bool
+}
+
+func newDataDiskUsageCache() *dataDiskUsageCache {
+	return &dataDiskUsageCache{
+		nodes: make(map[string]*nodeDataDiskUsage),
+	}
+}
+
+// ScrapeDataDiskUsage keeps the result of every node, so that a broken node does not hide the others.
+// A node which fails keeps its previous result, and its staleness grows.
+type ScrapeDataDiskUsage struct {
+	Memsqlctl memsqlctl.Client
+	// Parallelism is the maximum number of memsqlctl commands run at once
+	Parallelism int
+	// CommandTimeout limits every memsqlctl query, zero means no limit besides the timeout of memsqlctl.
+	// Both apply, so the shorter of them wins.
+	CommandTimeout time.Duration
+
+	cache *dataDiskUsageCache
+}
+
+func NewScrapeDataDiskUsage(client memsqlctl.Client, parallelism int, commandTimeout time.Duration, states *ScraperStates) *ScrapeDataDiskUsage {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &ScrapeDataDiskUsage{
+		Memsqlctl:      client,
+		Parallelism:    parallelism,
+		CommandTimeout: commandTimeout,
+		cache:          states.dataDiskUsage,
+	}
+}
+
+func (s *ScrapeDataDiskUsage) Name() string {
+	return "data_disk_usage"
+}
 
 func (s *ScrapeDataDiskUsage) Help() string {
 	return "Collect data disk usage by memsqlctl"
 }
 
-func (s *ScrapeDataDiskUsage) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) {
-	if dataDiskUsages == nil {
-		return
+// Scrape runs memsqlctl for every node, which takes too long (> 1s) to be run on every scrape.
+// The collector is run in the background by default, see collectors.data_disk_usage.background_interval.
+func (s *ScrapeDataDiskUsage) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if err := s.Refresh(ctx, db); err != nil {
+		return err
+	}
+	s.Serve(ch)
+	return nil
+}
+
+// Refresh queries the data disk usage of every node into the cache, at most Parallelism at once.
+func (s *ScrapeDataDiskUsage) Refresh(ctx context.Context, db *sqlx.DB) error {
+	// get memsql nodes first, shared with the other memsqlctl collectors
+	memsqlNodes, err := s.Memsqlctl.ListNodes(ctx)
+	if err != nil {
+		return err
 	}
 
-	dataDiskUsagesMu.Lock()
-	defer dataDiskUsagesMu.Unlock()
+	var wg sync.WaitGroup
+	var failedMu sync.Mutex
+	failed := 0
+	semaphore := make(chan struct{}, s.Parallelism)
+	for _, node := range memsqlNodes {
+		wg.Add(1)
+		go func(memsqlID string) {
+			defer wg.Done()
 
-	for _, usage := range dataDiskUsages {
-		blobsByte := usage.BlobsByte
-		logsByte := usage.LogsByte
-		otherByte := usage.OtherByte
-		snapshotByte := usage.SnapshotByte
-		tempBlobsByte := usage.TempBlobsByte
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				return
+			}
 
+			rows, err := s.queryNode(ctx, memsqlID)
+			if err != nil {
+				log.ErrorLogger.Errorf("data disk usage of node failed, keeping its previous result: memsql_id=%s error=%v", memsqlID, err)
+				failedMu.Lock()
+				failed++
+				failedMu.Unlock()
+
+				if ctx.Err() == nil {
+					s.cache.mu.Lock()
+					node, exists := s.cache.nodes[memsqlID]
+					if !exists {
+						node = &nodeDataDiskUsage{}
+						s.cache.nodes[memsqlID] = node
+					}
+					node.failed = true
+					s.cache.mu.Unlock()
+				}
+				return
+			}
+
+			s.cache.mu.Lock()
+			s.cache.nodes[memsqlID] = &nodeDataDiskUsage{
+				rows:        rows,
+				lastSuccess: time.Now(),
+			}
+			s.cache.mu.Unlock()
+		}(node.MemsqlId)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	listed := make(map[string]bool, len(memsqlNodes))
+	for _, node := range memsqlNodes {
+		listed[node.MemsqlId] = true
+	}
+	// forget nodes which were removed from the host
+	for memsqlID := range s.cache.nodes {
+		if !listed[memsqlID] {
+			delete(s.cache.nodes, memsqlID)
+		}
+	}
+
+	if failed > 0 && failed == len(memsqlNodes) {
+		return fmt.Errorf("data disk usage of every node failed: nodes=%d", failed)
+	}
+	s.cache.refreshed = true
+	return nil
+}
+
+// Refreshed tells whether a refresh succeeded, maybe before a reload. Until then an empty cache is not a result.
+func (s *ScrapeDataDiskUsage) Refreshed() bool {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	return s.cache.refreshed
+}
+
+// Serve sends the cached result of every node, with its staleness as of now.
+// A node which never succeeded only has its failure.
+func (s *ScrapeDataDiskUsage) Serve(ch chan<- prometheus.Metric) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	for memsqlID, node := range s.cache.nodes {
+		success := 1.0
+		if node.failed {
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(dataDiskUsageNodeSuccessDesc, prometheus.GaugeValue, success, memsqlID)
+
+		if node.lastSuccess.IsZero() {
+			continue
+		}
 		ch <- prometheus.MustNewConstMetric(
-			dataDiskUsageBlobsDesc, prometheus.GaugeValue, util.StringToFloat64(blobsByte),
-			usage.NodeID,
-			usage.DatabaseName,
-			usage.Ordinal,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			dataDiskUsageLogsDesc, prometheus.GaugeValue, util.StringToFloat64(logsByte),
-			usage.NodeID,
-			usage.DatabaseName,
-			usage.Ordinal,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			dataDiskUsageOthersDesc, prometheus.GaugeValue, util.StringToFloat64(otherByte),
-			usage.NodeID,
-			usage.DatabaseName,
-			usage.Ordinal,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			dataDiskUsageSnapshotDesc, prometheus.GaugeValue, util.StringToFloat64(snapshotByte),
-			usage.NodeID,
-			usage.DatabaseName,
-			usage.Ordinal,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			dataDiskUsageTempDesc, prometheus.GaugeValue, util.StringToFloat64(tempBlobsByte),
-			usage.NodeID,
-			usage.DatabaseName,
-			usage.Ordinal,
+			dataDiskUsageStalenessDesc, prometheus.GaugeValue, time.Since(node.lastSuccess).Seconds(),
+			memsqlID,
 		)
+
+		for _, usage := range node.rows {
+			sendDataDiskUsage(ch, usage)
+		}
+	}
+}
+
+func (s *ScrapeDataDiskUsage) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.CommandTimeout > 0 {
+		return context.WithTimeout(ctx, s.CommandTimeout)
 	}
+	return context.WithCancel(ctx)
+}
+
+func (s *ScrapeDataDiskUsage) queryNode(ctx context.Context, memsqlID string) ([]DataDiskUsage, error) {
+	ctx, cancel := s.commandContext(ctx)
+	defer cancel()
+
+	rows := make([]DataDiskUsage, 0)
+	if err := s.Memsqlctl.Query(ctx, memsqlID, infoSchemaDataDiskUsageQuery, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func sendDataDiskUsage(ch chan<- prometheus.Metric, usage DataDiskUsage) {
+	blobsByte := usage.BlobsByte
+	logsByte := usage.LogsByte
+	otherByte := usage.OtherByte
+	snapshotByte := usage.SnapshotByte
+	tempBlobsByte := usage.TempBlobsByte
+
+	ch <- prometheus.MustNewConstMetric(
+		dataDiskUsageBlobsDesc, prometheus.GaugeValue, util.StringToFloat64(blobsByte),
+		usage.NodeID,
+		usage.DatabaseName,
+		usage.Ordinal,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		dataDiskUsageLogsDesc, prometheus.GaugeValue, util.StringToFloat64(logsByte),
+		usage.NodeID,
+		usage.DatabaseName,
+		usage.Ordinal,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		dataDiskUsageOthersDesc, prometheus.GaugeValue, util.StringToFloat64(otherByte),
+		usage.NodeID,
+		usage.DatabaseName,
+		usage.Ordinal,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		dataDiskUsageSnapshotDesc, prometheus.GaugeValue, util.StringToFloat64(snapshotByte),
+		usage.NodeID,
+		usage.DatabaseName,
+		usage.Ordinal,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		dataDiskUsageTempDesc, prometheus.GaugeValue, util.StringToFloat64(tempBlobsByte),
+		usage.NodeID,
+		usage.DatabaseName,
+		usage.Ordinal,
+	)
 }
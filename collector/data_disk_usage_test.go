@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"singlestore_exporter/memsqlctl"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeDataDiskUsage(t *testing.T) {
+	row := func(nodeID string) string {
+		return `[{"NODE_ID": "` + nodeID + `", "DATABASE_NAME": "db", "ORDINAL": "0", "BLOBS_B": "1", "LOGS_B": "2", "OTHER_B": "3", "SNAPSHOTS_B": "4", "TEMP_BLOBS_B": "5"}]`
+	}
+	fake := &memsqlctl.Fake{
+		Nodes: []memsqlctl.Node{{MemsqlId: "A"}, {MemsqlId: "B"}},
+		QueryRows: map[string]string{
+			"A": row("1"),
+			"B": row("2"),
+		},
+	}
+	scraper := NewScrapeDataDiskUsage(fake, 2, 0, NewScraperStates())
+
+	// success, staleness and 5 metrics per node
+	metrics, err := collectMetrics(context.Background(), scraper, nil)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 14)
+
+	// a failing node keeps its previous result
+	fake.QueryErrs = map[string]error{"B": errors.New("node is down")}
+	metrics, err = collectMetrics(context.Background(), scraper, nil)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 14)
+
+	// the scrape fails when every node fails
+	fake.QueryErrs = map[string]error{"A": errors.New("node is down"), "B": errors.New("node is down")}
+	_, err = collectMetrics(context.Background(), scraper, nil)
+	assert.Error(t, err)
+
+	// nodes removed from the host are forgotten
+	fake.QueryErrs = nil
+	fake.Nodes = []memsqlctl.Node{{MemsqlId: "A"}}
+	metrics, err = collectMetrics(context.Background(), scraper, nil)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 7)
+
+	// list-nodes failing fails the scrape
+	fake.ListNodesErr = errors.New("memsqlctl not found")
+	_, err = collectMetrics(context.Background(), scraper, nil)
+	assert.Error(t, err)
+}
+
+func TestBackgroundDataDiskUsage(t *testing.T) {
+	row := func(nodeID string) string {
+		return `[{"NODE_ID": "` + nodeID + `", "DATABASE_NAME": "db", "ORDINAL": "0", "BLOBS_B": "1", "LOGS_B": "2", "OTHER_B": "3", "SNAPSHOTS_B": "4", "TEMP_BLOBS_B": "5"}]`
+	}
+	fake := &memsqlctl.Fake{
+		Nodes: []memsqlctl.Node{{MemsqlId: "A"}, {MemsqlId: "B"}},
+		QueryRows: map[string]string{
+			"A": row("1"),
+			"B": row("2"),
+		},
+	}
+	states := NewScraperStates()
+	staleness := func(scraper *BackgroundScraper) float64 {
+		ch := make(chan prometheus.Metric, 20)
+		assert.NoError(t, scraper.Scrape(context.Background(), nil, ch))
+		return metricValues(t, drain(ch))[dataDiskUsageStalenessDesc.String()+",memsql_id=B"]
+	}
+
+	registration := Registration{Scraper: NewScrapeDataDiskUsage(fake, 1, 0, states)}
+	scraper := NewBackgroundScraper(registration, time.Minute, nil)
+	scraper.run(context.Background())
+	assert.Less(t, staleness(scraper), 60.0)
+
+	// the staleness is computed when served, and grows while the node fails
+	fake.QueryErrs = map[string]error{"B": errors.New("node is down")}
+	scraper.run(context.Background())
+	states.dataDiskUsage.nodes["B"].lastSuccess = time.Now().Add(-time.Hour)
+	assert.GreaterOrEqual(t, staleness(scraper), 3600.0)
+
+	// a reload re-creates the scrapers, which serve the results of the nodes before their first run
+	registration = Registration{Scraper: NewScrapeDataDiskUsage(fake, 1, 0, states)}
+	scraper = NewBackgroundScraper(registration, time.Minute, nil)
+	assert.GreaterOrEqual(t, staleness(scraper), 3600.0)
+}
+
+func TestDataDiskUsageNeverSucceeded(t *testing.T) {
+	fake := &memsqlctl.Fake{
+		Nodes: []memsqlctl.Node{{MemsqlId: "A"}, {MemsqlId: "B"}},
+		QueryRows: map[string]string{
+			"A": `[{"NODE_ID": "1", "DATABASE_NAME": "db", "ORDINAL": "0", "BLOBS_B": "1", "LOGS_B": "2", "OTHER_B": "3", "SNAPSHOTS_B": "4", "TEMP_BLOBS_B": "5"}]`,
+		},
+		QueryErrs: map[string]error{"B": errors.New("node is down")},
+	}
+	scraper := NewBackgroundScraper(Registration{Scraper: NewScrapeDataDiskUsage(fake, 1, 0, NewScraperStates())}, time.Minute, nil)
+
+	// an empty cache is not a result before the first refresh
+	_, err := scrapeAll(scraper)
+	assert.Error(t, err)
+
+	scraper.run(context.Background())
+	ch := make(chan prometheus.Metric, 20)
+	assert.NoError(t, scraper.Scrape(context.Background(), nil, ch))
+	values := metricValues(t, drain(ch))
+
+	// the node failing since startup has its failure, but no staleness
+	assert.Equal(t, 1.0, values[dataDiskUsageNodeSuccessDesc.String()+",memsql_id=A"])
+	assert.Contains(t, values, dataDiskUsageStalenessDesc.String()+",memsql_id=A")
+	assert.Equal(t, 0.0, values[dataDiskUsageNodeSuccessDesc.String()+",memsql_id=B"])
+	assert.Contains(t, values, dataDiskUsageNodeSuccessDesc.String()+",memsql_id=B")
+	assert.NotContains(t, values, dataDiskUsageStalenessDesc.String()+",memsql_id=B")
+}
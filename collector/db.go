@@ -0,0 +1,283 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"time"
+
+	"singlestore_exporter/log"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	exporter = "exporter"
+
+	dbPoolBackoffMin = 1 * time.Second
+	dbPoolBackoffMax = 1 * time.Minute
+)
+
+var (
+	dbPoolMaxOpenConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_max_open_connections"),
+		"Maximum number of open connections to the database",
+		nil,
+		nil,
+	)
+
+	dbPoolOpenConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_open_connections"),
+		"The number of established connections both in use and idle",
+		nil,
+		nil,
+	)
+
+	dbPoolInUseConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_in_use_connections"),
+		"The number of connections currently in use",
+		nil,
+		nil,
+	)
+
+	dbPoolIdleConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_idle_connections"),
+		"The number of idle connections",
+		nil,
+		nil,
+	)
+
+	dbPoolWaitCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_wait_count_total"),
+		"The total number of connections waited for",
+		nil,
+		nil,
+	)
+
+	dbPoolWaitDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_wait_duration_seconds_total"),
+		"The total time blocked waiting for a new connection",
+		nil,
+		nil,
+	)
+
+	dbPoolMaxIdleClosedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_max_idle_closed_total"),
+		"The total number of connections closed due to max idle connections",
+		nil,
+		nil,
+	)
+
+	dbPoolMaxIdleTimeClosedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_max_idle_time_closed_total"),
+		"The total number of connections closed due to max idle time",
+		nil,
+		nil,
+	)
+
+	dbPoolMaxLifetimeClosedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_max_lifetime_closed_total"),
+		"The total number of connections closed due to max connection lifetime",
+		nil,
+		nil,
+	)
+
+	dbPoolOpensDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "db_pool_opens_total"),
+		"The total number of times the connection pool was opened",
+		nil,
+		nil,
+	)
+)
+
+type DBPoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DBPool keeps one long-lived connection pool to the aggregator.
+// When the database can not be reached, the pool is dropped and re-created
+// on a later scrape, waiting longer between attempts after every failure.
+type DBPool struct {
+	cfg  *mysql.Config
+	opts DBPoolOptions
+	// redactedDSN is the only form of the DSN which may be logged
+	redactedDSN string
+	// newConnector is mysql.NewConnector, replaced by tests
+	newConnector func(cfg *mysql.Config) (driver.Connector, error)
+
+	mu          sync.Mutex
+	db          *sqlx.DB
+	lastErr     error
+	backoff     time.Duration
+	nextAttempt time.Time
+	opens       int
+}
+
+func NewDBPool(cfg *mysql.Config, opts DBPoolOptions) *DBPool {
+	return &DBPool{
+		cfg:          cfg,
+		opts:         opts,
+		redactedDSN:  RedactDSN(cfg),
+		newConnector: mysql.NewConnector,
+	}
+}
+
+// RedactDSN formats cfg with the password masked, for logs and error messages.
+func RedactDSN(cfg *mysql.Config) string {
+	redacted := cfg.Clone()
+	if redacted.Passwd != "" {
+		redacted.Passwd = "xxxxx"
+	}
+	return redacted.FormatDSN()
+}
+
+// DB returns a healthy connection pool, or an error if the database is not reachable.
+// The pool is pinged without holding the lock, so that a hanging ping only blocks its own caller.
+func (p *DBPool) DB(ctx context.Context) (*sqlx.DB, error) {
+	p.mu.Lock()
+	if p.db == nil {
+		if time.Now().Before(p.nextAttempt) {
+			defer p.mu.Unlock()
+			return nil, fmt.Errorf("waiting %s before reconnecting: last error=%v", time.Until(p.nextAttempt).Round(time.Second), p.lastErr)
+		}
+
+		connector, err := p.newConnector(p.cfg)
+		if err != nil {
+			defer p.mu.Unlock()
+			return nil, p.fail(fmt.Errorf("dsn is not valid: dsn=%s err=%v", p.redactedDSN, err))
+		}
+		db := sqlx.NewDb(sql.OpenDB(connector), "mysql")
+		db.SetMaxOpenConns(p.opts.MaxOpenConns)
+		db.SetMaxIdleConns(p.opts.MaxIdleConns)
+		db.SetConnMaxLifetime(p.opts.ConnMaxLifetime)
+
+		p.db = db
+		p.opens++
+	}
+	db := p.db
+	p.mu.Unlock()
+
+	pingErr := db.PingContext(ctx)
+
+	p.mu.Lock()
+	// another caller may have dropped the pool in the meantime, or Close may have been called
+	current := p.db == db
+	if pingErr == nil {
+		defer p.mu.Unlock()
+		if !current {
+			return nil, fmt.Errorf("connection pool was closed: dsn=%s", p.redactedDSN)
+		}
+		p.lastErr = nil
+		p.backoff = 0
+		return db, nil
+	}
+
+	err := fmt.Errorf("connection failed: dsn=%s err=%v", p.redactedDSN, pingErr)
+	if ctx.Err() != nil || !current {
+		// the scrape was cancelled and the pool itself may still be fine, or its failure was already counted
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.db = nil
+	err = p.fail(err)
+	p.mu.Unlock()
+
+	// closing waits for the queries in flight, which must not hold the lock
+	if err := db.Close(); err != nil {
+		log.ErrorLogger.Errorf("failed to close db: err=%v", err)
+	}
+	return nil, err
+}
+
+// Check returns an error if the database is not reachable. Unlike DB, a failure does not drop the pool
+// nor delay its next attempt, so that health checks do not interfere with scrapes.
+// While the pool is waiting to reconnect, a single connection is opened and closed.
+func (p *DBPool) Check(ctx context.Context) error {
+	p.mu.Lock()
+	db := p.db
+	p.mu.Unlock()
+
+	if db != nil {
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("connection failed: dsn=%s err=%v", p.redactedDSN, err)
+		}
+		return nil
+	}
+
+	connector, err := p.newConnector(p.cfg)
+	if err != nil {
+		return fmt.Errorf("dsn is not valid: dsn=%s err=%v", p.redactedDSN, err)
+	}
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connection failed: dsn=%s err=%v", p.redactedDSN, err)
+	}
+	if err := conn.Close(); err != nil {
+		log.ErrorLogger.Errorf("failed to close db: err=%v", err)
+	}
+	return nil
+}
+
+func (p *DBPool) fail(err error) error {
+	if p.backoff == 0 {
+		p.backoff = dbPoolBackoffMin
+	} else if p.backoff *= 2; p.backoff > dbPoolBackoffMax {
+		p.backoff = dbPoolBackoffMax
+	}
+	p.lastErr = err
+	p.nextAttempt = time.Now().Add(p.backoff)
+	return err
+}
+
+func (p *DBPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.db == nil {
+		return nil
+	}
+	err := p.db.Close()
+	p.db = nil
+	return err
+}
+
+func (p *DBPool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbPoolMaxOpenConnectionsDesc
+	ch <- dbPoolOpenConnectionsDesc
+	ch <- dbPoolInUseConnectionsDesc
+	ch <- dbPoolIdleConnectionsDesc
+	ch <- dbPoolWaitCountDesc
+	ch <- dbPoolWaitDurationDesc
+	ch <- dbPoolMaxIdleClosedDesc
+	ch <- dbPoolMaxIdleTimeClosedDesc
+	ch <- dbPoolMaxLifetimeClosedDesc
+	ch <- dbPoolOpensDesc
+}
+
+func (p *DBPool) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(dbPoolOpensDesc, prometheus.CounterValue, float64(p.opens))
+
+	if p.db == nil {
+		return
+	}
+
+	stats := p.db.Stats()
+	ch <- prometheus.MustNewConstMetric(dbPoolMaxOpenConnectionsDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbPoolOpenConnectionsDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbPoolInUseConnectionsDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbPoolIdleConnectionsDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbPoolWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbPoolWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(dbPoolMaxIdleClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(dbPoolMaxIdleTimeClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed))
+	ch <- prometheus.MustNewConstMetric(dbPoolMaxLifetimeClosedDesc, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactDSN(t *testing.T) {
+	tt := []struct {
+		name     string
+		dsn      string
+		expected string
+	}{
+		{
+			name:     "password is masked",
+			dsn:      "exporter:secret@tcp(aggregator:3306)/information_schema?parseTime=true",
+			expected: "exporter:xxxxx@tcp(aggregator:3306)/information_schema?parseTime=true",
+		},
+		{
+			name:     "password with special characters",
+			dsn:      "exporter:s3cr@t:/(x)@tcp(aggregator:3306)/",
+			expected: "exporter:xxxxx@tcp(aggregator:3306)/",
+		},
+		{
+			name:     "no password",
+			dsn:      "exporter@unix(/var/run/memsql.sock)/",
+			expected: "exporter@unix(/var/run/memsql.sock)/",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := mysql.ParseDSN(tc.dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expected, RedactDSN(cfg))
+			// the config of the pool is left untouched
+			assert.NotEqual(t, "xxxxx", cfg.Passwd)
+		})
+	}
+}
+
+// fakeConnector connects to a database which is down while down is set.
+// While block is set, connections hang until it is closed, and each attempt is sent to connecting.
+type fakeConnector struct {
+	mu         sync.Mutex
+	down       bool
+	connects   int
+	block      chan struct{}
+	connecting chan struct{}
+}
+
+func (c *fakeConnector) setDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+func (c *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	c.connects++
+	block := c.block
+	c.mu.Unlock()
+
+	if block != nil {
+		c.connecting <- struct{}{}
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return nil, errors.New("connection refused")
+	}
+	return fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (c fakeConn) Ping(ctx context.Context) error {
+	c.connector.mu.Lock()
+	defer c.connector.mu.Unlock()
+	if c.connector.down {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func newTestDBPool(connector *fakeConnector) *DBPool {
+	pool := NewDBPool(mysql.NewConfig(), DBPoolOptions{MaxOpenConns: 1, MaxIdleConns: 1})
+	pool.newConnector = func(cfg *mysql.Config) (driver.Connector, error) {
+		return connector, nil
+	}
+	return pool
+}
+
+// elapseBackoff lets the next call of DB reconnect, as if the backoff had passed.
+func elapseBackoff(pool *DBPool) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.nextAttempt = time.Now()
+}
+
+func TestDBPoolReconnect(t *testing.T) {
+	connector := &fakeConnector{down: true}
+	pool := newTestDBPool(connector)
+	ctx := context.Background()
+
+	_, err := pool.DB(ctx)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, dbPoolBackoffMin, pool.backoff)
+
+	// no attempt is made during the backoff, the last error is returned
+	connects := connector.connects
+	_, err = pool.DB(ctx)
+	assert.ErrorContains(t, err, "waiting")
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, connects, connector.connects)
+
+	// the pool is re-created once the database is back and the backoff passed
+	connector.setDown(false)
+	elapseBackoff(pool)
+	db, err := pool.DB(ctx)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+	assert.Equal(t, 2, pool.opens)
+	assert.Zero(t, pool.backoff)
+	assert.NoError(t, pool.lastErr)
+
+	// a healthy pool is reused
+	reused, err := pool.DB(ctx)
+	assert.NoError(t, err)
+	assert.Same(t, db, reused)
+	assert.Equal(t, 2, pool.opens)
+
+	// a pool which stops answering is dropped
+	connector.setDown(true)
+	_, err = pool.DB(ctx)
+	assert.Error(t, err)
+	assert.Nil(t, pool.db)
+	assert.Equal(t, dbPoolBackoffMin, pool.backoff)
+
+	assert.NoError(t, pool.Close())
+}
+
+func TestDBPoolBackoff(t *testing.T) {
+	connector := &fakeConnector{down: true}
+	pool := newTestDBPool(connector)
+
+	expected := []time.Duration{
+		dbPoolBackoffMin,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		16 * time.Second,
+		32 * time.Second,
+		dbPoolBackoffMax,
+		dbPoolBackoffMax,
+	}
+	for _, backoff := range expected {
+		elapseBackoff(pool)
+		_, err := pool.DB(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, backoff, pool.backoff)
+		assert.WithinDuration(t, time.Now().Add(backoff), pool.nextAttempt, time.Second)
+	}
+}
+
+func TestDBPoolCloseDuringBackoff(t *testing.T) {
+	connector := &fakeConnector{down: true}
+	pool := newTestDBPool(connector)
+	ctx := context.Background()
+
+	_, err := pool.DB(ctx)
+	assert.Error(t, err)
+
+	// nothing is open while waiting to reconnect, and the backoff is kept
+	assert.NoError(t, pool.Close())
+	_, err = pool.DB(ctx)
+	assert.ErrorContains(t, err, "waiting")
+
+	connector.setDown(false)
+	elapseBackoff(pool)
+	_, err = pool.DB(ctx)
+	assert.NoError(t, err)
+
+	// a closed pool is re-created on the next call
+	assert.NoError(t, pool.Close())
+	assert.Nil(t, pool.db)
+	_, err = pool.DB(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pool.opens)
+	assert.NoError(t, pool.Close())
+}
+
+func TestDBPoolHangingPing(t *testing.T) {
+	connector := &fakeConnector{block: make(chan struct{}), connecting: make(chan struct{}, 10)}
+	pool := newTestDBPool(connector)
+	pool.opts.MaxOpenConns = 10
+
+	hanging := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := pool.DB(context.Background())
+			hanging <- err
+		}()
+		<-connector.connecting
+	}
+
+	// the hanging pings block neither the metrics of the pool nor callers giving up
+	ch := make(chan prometheus.Metric, 20)
+	pool.Collect(ch)
+	assert.NotEmpty(t, drain(ch))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-connector.connecting
+	}()
+	_, err := pool.DB(ctx)
+	assert.ErrorContains(t, err, "deadline exceeded")
+	assert.NotNil(t, pool.db)
+
+	// both pings fail, but the pool is dropped and its backoff started once
+	connector.setDown(true)
+	close(connector.block)
+	assert.Error(t, <-hanging)
+	assert.Error(t, <-hanging)
+	assert.Nil(t, pool.db)
+	assert.Equal(t, dbPoolBackoffMin, pool.backoff)
+}
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -31,58 +32,92 @@ var (
 		[]string{},
 		nil,
 	)
+
+	scrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "scrape_collector_duration_seconds"),
+		"Duration of a collector scrape",
+		[]string{"collector"},
+		nil,
+	)
+
+	scrapeSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "scrape_collector_success"),
+		"Whether a collector succeeded",
+		[]string{"collector"},
+		nil,
+	)
+
+	errNoConnection = errors.New("no connection to the database")
+
+	scrapeErrorsTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "scrape_collector_errors_total"),
+		"Total number of failed scrapes of a collector, or of its background runs",
+		[]string{"collector"},
+		nil,
+	)
+
+	// scrapeErrors counts the failed scrapes per target, so that a /probe target only reports its own errors.
+	// It outlives a single Exporter, so it is kept at package level.
+	scrapeErrors = newTargetStates(newScrapeErrorsState)
 )
 
-type Exporter struct {
-	ctx      context.Context
-	version  string
-	dsn      string
-	scrapers []Scraper
+type scrapeErrorsState struct {
+	totals map[string]float64
 }
 
-type ExporterFlags struct {
-	FlagSlowQuery                      bool
-	FlagSlowQueryThreshold             int
-	FlagReplicationStatus              bool
-	FlagDataDiskUsage                  bool
-	FlagActiveTransactionPtr           bool
-	FlagSlowQueryExceptionHosts        []string
-	FlagSlowQueryExceptionInfoPatterns []string
+func newScrapeErrorsState() *scrapeErrorsState {
+	return &scrapeErrorsState{totals: make(map[string]float64)}
 }
 
+// countScrapeError counts a failed scrape of the collector name for the target of ctx
+func countScrapeError(ctx context.Context, name string) {
+	scrapeErrors.update(ctx, func(state *scrapeErrorsState) []prometheus.Metric {
+		state.totals[name]++
+		return nil
+	})
+}
+
+func scrapeErrorsMetrics(ctx context.Context) []prometheus.Metric {
+	return scrapeErrors.update(ctx, func(state *scrapeErrorsState) []prometheus.Metric {
+		metrics := make([]prometheus.Metric, 0, len(state.totals))
+		for name, total := range state.totals {
+			metrics = append(metrics, prometheus.MustNewConstMetric(scrapeErrorsTotalDesc, prometheus.CounterValue, total, name))
+		}
+		return metrics
+	})
+}
+
+type Exporter struct {
+	ctx           context.Context
+	version       string
+	pool          *DBPool
+	registrations []Registration
+}
+
+// New creates an exporter for a single scrape. pool is nil when no DSN is configured,
+// in which case scrapers requiring a DSN are skipped.
 func New(
 	ctx context.Context,
 	version string,
-	dsn string,
-	flags *ExporterFlags,
+	pool *DBPool,
+	registrations []Registration,
 ) *Exporter {
-	scrapers := []Scraper{
-		&ScrapeNodes{},
-	}
-	if dsn != "" {
-		scrapers = append(scrapers,
-			&ScrapeCachedBlobs{},
-			&ScrapePipeline{},
-		)
-		if flags.FlagSlowQuery {
-			scrapers = append(scrapers, NewScrapeProcessList(flags.FlagSlowQueryThreshold, flags.FlagSlowQueryExceptionHosts, flags.FlagSlowQueryExceptionInfoPatterns))
-		}
-		if flags.FlagReplicationStatus {
-			scrapers = append(scrapers, &ScrapeReplicationStatus{})
-		}
-		if flags.FlagActiveTransactionPtr {
-			scrapers = append(scrapers, &ScrapeActiveTransactions{})
+	enabled := make([]Registration, 0, len(registrations))
+	for _, registration := range registrations {
+		if registration.RequiresDSN && pool == nil {
+			continue
 		}
+		enabled = append(enabled, registration)
 	}
-	if flags.FlagDataDiskUsage {
-		scrapers = append(scrapers, &ScrapeDataDiskUsage{})
+	if pool != nil {
+		ctx = withTargetKey(ctx, pool.redactedDSN)
 	}
 
 	return &Exporter{
 		ctx,
 		version,
-		dsn,
-		scrapers,
+		pool,
+		enabled,
 	}
 }
 
@@ -91,64 +126,96 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	e.scrape(e.dsn, ch)
+	e.scrape(ch)
+	for _, metric := range scrapeErrorsMetrics(e.ctx) {
+		ch <- metric
+	}
 }
 
-func (e *Exporter) scrape(dsn string, ch chan<- prometheus.Metric) {
+func (e *Exporter) scrape(ch chan<- prometheus.Metric) {
 	var db *sqlx.DB
 	var err error
 
 	ch <- prometheus.MustNewConstMetric(exporterVersionDesc, prometheus.GaugeValue, 1, e.version)
 
-	if dsn != "" {
-		db, err = e.conn(dsn + "information_schema?parseTime=true")
-		if db != nil {
-			defer func(db *sqlx.DB) {
-				err := db.Close()
-				if err != nil {
-					log.ErrorLogger.Errorf("failed to close db: err=%v", err)
-				}
-			}(db)
-			ch <- prometheus.MustNewConstMetric(dbConnectionSuccessfulDesc, prometheus.GaugeValue, 1)
-		} else if err != nil {
+	if e.pool != nil {
+		db, err = e.pool.DB(e.ctx)
+		if err != nil {
 			log.ErrorLogger.Errorf("db conn failed: err=%v", err)
 			ch <- prometheus.MustNewConstMetric(dbConnectionSuccessfulDesc, prometheus.GaugeValue, 0)
+		} else {
+			ch <- prometheus.MustNewConstMetric(dbConnectionSuccessfulDesc, prometheus.GaugeValue, 1)
 		}
 	}
 
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
-	for _, scraper := range e.scrapers {
+	for _, registration := range e.registrations {
 		wg.Add(1)
-		go func(scraper Scraper) {
+		go func(registration Registration) {
 			defer wg.Done()
-			scraper.Scrape(e.ctx, db, ch)
-		}(scraper)
+			e.scrapeOne(registration, db, ch)
+		}(registration)
 	}
 }
 
-func (e *Exporter) conn(dsn string) (*sqlx.DB, error) {
-	if dsn == "" {
-		return nil, nil
-	}
+func (e *Exporter) scrapeOne(registration Registration, db *sqlx.DB, ch chan<- prometheus.Metric) {
+	name := registration.Scraper.Name()
+	start := time.Now()
+	metrics, err := scrapeWithTimeout(e.ctx, registration, db)
+	duration := time.Since(start).Seconds()
 
-	db, err := sqlx.Open("mysql", dsn)
+	success := 1.0
 	if err != nil {
-		return nil, fmt.Errorf("dsn is not valid: dsn=%s, err=%v", dsn, err)
+		log.ErrorLogger.Errorf("scraper failed: collector=%s error=%v", name, err)
+		// a background collector serves the error of its last run on every scrape, its runs count it once
+		if _, isBackground := registration.Scraper.(*BackgroundScraper); !isBackground {
+			countScrapeError(e.ctx, name)
+		}
+		success = 0
 	}
 
-	db.SetMaxOpenConns(1)
-	db.SetMaxIdleConns(1)
-	db.SetConnMaxLifetime(1 * time.Minute)
+	for _, metric := range metrics {
+		ch <- metric
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration, name)
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+}
 
-	if err := db.Ping(); err != nil {
-		err := db.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to close db: dsn=%s, err=%v", dsn, err)
-		}
-		return nil, fmt.Errorf("connection failed: dsn=%s, err=%v", dsn, err)
+// scrapeWithTimeout runs the scraper until it returns, or until its timeout or the scrape deadline is reached.
+// A scraper which runs out of time is abandoned: its metrics are dropped, so that the other collectors
+// can still be returned to Prometheus.
+func scrapeWithTimeout(ctx context.Context, registration Registration, db *sqlx.DB) ([]prometheus.Metric, error) {
+	start := time.Now()
+	if registration.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, registration.Timeout)
+		defer cancel()
 	}
 
-	return db, nil
+	ch := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+	go func() {
+		done <- registration.Scraper.Scrape(ctx, db, ch)
+		close(ch)
+	}()
+
+	metrics := make([]prometheus.Metric, 0)
+	for {
+		select {
+		case metric, ok := <-ch:
+			if !ok {
+				return metrics, <-done
+			}
+			metrics = append(metrics, metric)
+		case <-ctx.Done():
+			// the scraper may still be running, keep it from blocking on ch
+			go func() {
+				for range ch {
+				}
+			}()
+			return nil, fmt.Errorf("scraper abandoned after %s: %v", time.Since(start).Round(time.Millisecond), context.Cause(ctx))
+		}
+	}
 }
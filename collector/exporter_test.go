@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"singlestore_exporter/log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.InitLoggers("", "error", ""); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+var testDesc = prometheus.NewDesc("test_metric", "test metric", nil, nil)
+
+type sleepScraper struct {
+	sleep time.Duration
+}
+
+func (s *sleepScraper) Name() string {
+	return "sleep"
+}
+
+func (s *sleepScraper) Help() string {
+	return "Sleeps before sending a metric"
+}
+
+func (s *sleepScraper) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 1)
+	time.Sleep(s.sleep)
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 2)
+	return nil
+}
+
+func TestScrapeWithTimeout(t *testing.T) {
+	tt := []struct {
+		name            string
+		sleep           time.Duration
+		timeout         time.Duration
+		expectedErr     bool
+		expectedMetrics int
+	}{
+		{
+			name:            "no timeout",
+			sleep:           10 * time.Millisecond,
+			expectedMetrics: 2,
+		},
+		{
+			name:            "within timeout",
+			sleep:           10 * time.Millisecond,
+			timeout:         time.Second,
+			expectedMetrics: 2,
+		},
+		{
+			name:            "abandoned after timeout",
+			sleep:           time.Second,
+			timeout:         10 * time.Millisecond,
+			expectedErr:     true,
+			expectedMetrics: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			registration := Registration{
+				Scraper: &sleepScraper{sleep: tc.sleep},
+				Timeout: tc.timeout,
+			}
+
+			metrics, err := scrapeWithTimeout(context.Background(), registration, nil)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, metrics, tc.expectedMetrics)
+		})
+	}
+}
+
+// dbScraper fails without a connection
+type dbScraper struct{}
+
+func (s dbScraper) Name() string {
+	return "db"
+}
+
+func (s dbScraper) Help() string {
+	return "Fails without a connection"
+}
+
+func (s dbScraper) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if db == nil {
+		return errNoConnection
+	}
+	return nil
+}
+
+func TestScrapeErrorsPerTarget(t *testing.T) {
+	up := newTestDBPool(&fakeConnector{})
+	up.redactedDSN = "exporter@tcp(up:3306)/"
+	down := newTestDBPool(&fakeConnector{down: true})
+	down.redactedDSN = "exporter@tcp(down:3306)/"
+	registrations := []Registration{{Scraper: dbScraper{}, RequiresDSN: true}}
+
+	// errors of the collector as reported by a probe of the target of pool
+	probe := func(pool *DBPool) float64 {
+		ch := make(chan prometheus.Metric, 10)
+		New(context.Background(), "test", pool, registrations).Collect(ch)
+		return metricValues(t, drain(ch))[scrapeErrorsTotalDesc.String()+",collector=db"]
+	}
+
+	for i := 1; i <= 2; i++ {
+		assert.Equal(t, float64(i), probe(down))
+		assert.Zero(t, probe(up))
+	}
+	assert.NoError(t, up.Close())
+}
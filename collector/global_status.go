@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type GlobalStatus struct {
+	NodeID        int64  `db:"NODE_ID"`
+	VariableName  string `db:"VARIABLE_NAME"`
+	VariableValue string `db:"VARIABLE_VALUE"`
+}
+
+const (
+	globalStatus = "global_status"
+
+	infoSchemaGlobalStatusQuery = `SELECT NODE_ID, VARIABLE_NAME, NVL(VARIABLE_VALUE, '') AS VARIABLE_VALUE
+FROM information_schema.MV_GLOBAL_STATUS`
+)
+
+var (
+	// statusValueRegexp matches numbers, optionally followed by a change in parentheses and a unit, e.g. "241.2 (+0.1) MB"
+	statusValueRegexp = regexp.MustCompile(`^([-+]?[0-9]*\.?[0-9]+(?:[eE][-+]?[0-9]+)?)(?:\s*\([^)]*\))?\s*(B|KB|MB|GB|TB)?$`)
+
+	// invalidMetricNameRegexp matches what may not be part of a metric name
+	invalidMetricNameRegexp = regexp.MustCompile(`[^a-z0-9_]+`)
+
+	statusValueUnits = map[string]float64{
+		"":   1,
+		"B":  1,
+		"KB": 1 << 10,
+		"MB": 1 << 20,
+		"GB": 1 << 30,
+		"TB": 1 << 40,
+	}
+
+	// globalStatusVariables are the status variables with a known type, by lower case name
+	globalStatusVariables = map[string]globalStatusVariable{
+		"aborted_clients":          {prometheus.CounterValue, "Connections aborted because the client did not close them properly"},
+		"aborted_connects":         {prometheus.CounterValue, "Failed attempts to connect"},
+		"bytes_received":           {prometheus.CounterValue, "Bytes received from clients"},
+		"bytes_sent":               {prometheus.CounterValue, "Bytes sent to clients"},
+		"connections":              {prometheus.CounterValue, "Connection attempts, successful or not"},
+		"queries":                  {prometheus.CounterValue, "Statements executed, including those of stored procedures"},
+		"questions":                {prometheus.CounterValue, "Statements sent by clients"},
+		"successful_read_queries":  {prometheus.CounterValue, "Read queries which succeeded"},
+		"successful_write_queries": {prometheus.CounterValue, "Write queries which succeeded"},
+		"failed_read_queries":      {prometheus.CounterValue, "Read queries which failed"},
+		"failed_write_queries":     {prometheus.CounterValue, "Write queries which failed"},
+		"threads_created":          {prometheus.CounterValue, "Threads created to handle connections"},
+		"threads_connected":        {prometheus.GaugeValue, "Currently open connections"},
+		"threads_running":          {prometheus.GaugeValue, "Threads which are not sleeping"},
+		"threads_cached":           {prometheus.GaugeValue, "Threads in the thread cache"},
+		"max_used_connections":     {prometheus.GaugeValue, "Maximum number of connections open at the same time since the node started"},
+		"open_tables":              {prometheus.GaugeValue, "Tables which are open"},
+		"uptime":                   {prometheus.GaugeValue, "Seconds since the node started"},
+	}
+)
+
+type globalStatusVariable struct {
+	valueType prometheus.ValueType
+	help      string
+}
+
+// parseStatusValue parses the value of a status variable or of a global variable.
+// It returns the value in bytes when the value has a unit.
+func parseStatusValue(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	switch strings.ToUpper(value) {
+	case "ON", "YES", "TRUE":
+		return 1, true
+	case "OFF", "NO", "FALSE":
+		return 0, true
+	}
+
+	match := statusValueRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return number * statusValueUnits[match[2]], true
+}
+
+// isMemoryStatus tells whether a status variable is an amount of memory, reported in MB
+func isMemoryStatus(name string) bool {
+	return strings.HasPrefix(name, "alloc_") || strings.HasSuffix(name, "_memory")
+}
+
+// ScrapeGlobalStatus exports the status variables of every node. Known variables are typed,
+// the amounts of memory are gauges in bytes, and the other variables are exported as untyped
+// only when they match the allowlist.
+type ScrapeGlobalStatus struct {
+	// Allowlist selects the unknown variables to export, by lower case name with invalid characters replaced by _
+	Allowlist []*regexp.Regexp
+}
+
+func NewScrapeGlobalStatus(allowlist []*regexp.Regexp) *ScrapeGlobalStatus {
+	return &ScrapeGlobalStatus{
+		Allowlist: allowlist,
+	}
+}
+
+func (s *ScrapeGlobalStatus) Name() string {
+	return "global_status"
+}
+
+func (s *ScrapeGlobalStatus) Help() string {
+	return "Collect status variables of every node from information_schema.MV_GLOBAL_STATUS"
+}
+
+func (s *ScrapeGlobalStatus) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if db == nil {
+		return errNoConnection
+	}
+
+	rows := make([]GlobalStatus, 0)
+	if err := db.SelectContext(ctx, &rows, infoSchemaGlobalStatusQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaGlobalStatusQuery, err)
+	}
+
+	descs := make(map[string]*prometheus.Desc)
+	for _, row := range rows {
+		desc, valueType, ok := s.describe(descs, row.VariableName)
+		if !ok {
+			continue
+		}
+		value, ok := parseStatusValue(row.VariableValue)
+		if !ok {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(desc, valueType, value, strconv.FormatInt(row.NodeID, 10))
+	}
+
+	return nil
+}
+
+// describe returns the desc and type of a status variable, and false when it is not exported.
+// descs caches the descs of a scrape, which are shared by the nodes.
+func (s *ScrapeGlobalStatus) describe(descs map[string]*prometheus.Desc, variableName string) (*prometheus.Desc, prometheus.ValueType, bool) {
+	name := invalidMetricNameRegexp.ReplaceAllString(strings.ToLower(variableName), "_")
+
+	var (
+		metricName string
+		help       string
+		valueType  prometheus.ValueType
+	)
+	if variable, exists := globalStatusVariables[name]; exists {
+		metricName, help, valueType = name, variable.help, variable.valueType
+		if valueType == prometheus.CounterValue {
+			metricName += "_total"
+		}
+	} else if isMemoryStatus(name) {
+		metricName, help, valueType = name+"_bytes", "Memory of status variable "+variableName, prometheus.GaugeValue
+	} else if s.allowed(name) {
+		metricName, help, valueType = name, "Status variable "+variableName, prometheus.UntypedValue
+	} else {
+		return nil, 0, false
+	}
+
+	desc, exists := descs[metricName]
+	if !exists {
+		desc = prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, globalStatus, metricName),
+			help,
+			[]string{"node_id"},
+			nil,
+		)
+		descs[metricName] = desc
+	}
+	return desc, valueType, true
+}
+
+func (s *ScrapeGlobalStatus) allowed(name string) bool {
+	for _, re := range s.Allowlist {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
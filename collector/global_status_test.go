@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatusValue(t *testing.T) {
+	tt := []struct {
+		value      string
+		expected   float64
+		expectedOk bool
+	}{
+		{value: "42", expected: 42, expectedOk: true},
+		{value: " 1.5 ", expected: 1.5, expectedOk: true},
+		{value: "241.5 (+0.5) MB", expected: 241.5 * 1024 * 1024, expectedOk: true},
+		{value: "2 GB", expected: 2 * 1024 * 1024 * 1024, expectedOk: true},
+		{value: "ON", expected: 1, expectedOk: true},
+		{value: "off", expected: 0, expectedOk: true},
+		{value: "", expectedOk: false},
+		{value: "utf8mb4_general_ci", expectedOk: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.value, func(t *testing.T) {
+			value, ok := parseStatusValue(tc.value)
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestScrapeGlobalStatusDescribe(t *testing.T) {
+	scraper := NewScrapeGlobalStatus([]*regexp.Regexp{regexp.MustCompile(`^com_.*$`)})
+
+	tt := []struct {
+		variable     string
+		expectedOk   bool
+		expectedName string
+		expectedType prometheus.ValueType
+	}{
+		{variable: "Connections", expectedOk: true, expectedName: "singlestore_global_status_connections_total", expectedType: prometheus.CounterValue},
+		{variable: "Threads_running", expectedOk: true, expectedName: "singlestore_global_status_threads_running", expectedType: prometheus.GaugeValue},
+		{variable: "Total_server_memory", expectedOk: true, expectedName: "singlestore_global_status_total_server_memory_bytes", expectedType: prometheus.GaugeValue},
+		{variable: "Alloc_query_execution", expectedOk: true, expectedName: "singlestore_global_status_alloc_query_execution_bytes", expectedType: prometheus.GaugeValue},
+		{variable: "Com_select", expectedOk: true, expectedName: "singlestore_global_status_com_select", expectedType: prometheus.UntypedValue},
+		{variable: "Ssl_version", expectedOk: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.variable, func(t *testing.T) {
+			desc, valueType, ok := scraper.describe(make(map[string]*prometheus.Desc), tc.variable)
+			assert.Equal(t, tc.expectedOk, ok)
+			if !ok {
+				return
+			}
+			assert.Contains(t, desc.String(), `fqName: "`+tc.expectedName+`"`)
+			assert.Equal(t, tc.expectedType, valueType)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type GlobalVariable struct {
+	NodeID        int64  `db:"NODE_ID"`
+	VariableName  string `db:"VARIABLE_NAME"`
+	VariableValue string `db:"VARIABLE_VALUE"`
+}
+
+const (
+	globalVariables = "global_variables"
+
+	infoSchemaGlobalVariablesQuery = `SELECT NODE_ID, VARIABLE_NAME, NVL(VARIABLE_VALUE, '') AS VARIABLE_VALUE
+FROM information_schema.MV_GLOBAL_VARIABLES`
+)
+
+var (
+	variableInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "variable", "info"),
+		"The value of a global variable which is not a number",
+		[]string{"node_id", "name", "value"},
+		nil,
+	)
+)
+
+// ScrapeGlobalVariables exports the numeric global variables of every node as gauges, ON and OFF as 1 and 0,
+// and the other variables matching the allowlist as singlestore_variable_info.
+type ScrapeGlobalVariables struct {
+	// InfoAllowlist selects the variables exported as info, by lower case name
+	InfoAllowlist []*regexp.Regexp
+}
+
+func NewScrapeGlobalVariables(infoAllowlist []*regexp.Regexp) *ScrapeGlobalVariables {
+	return &ScrapeGlobalVariables{
+		InfoAllowlist: infoAllowlist,
+	}
+}
+
+func (s *ScrapeGlobalVariables) Name() string {
+	return "global_variables"
+}
+
+func (s *ScrapeGlobalVariables) Help() string {
+	return "Collect global variables of every node from information_schema.MV_GLOBAL_VARIABLES"
+}
+
+func (s *ScrapeGlobalVariables) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if db == nil {
+		return errNoConnection
+	}
+
+	rows := make([]GlobalVariable, 0)
+	if err := db.SelectContext(ctx, &rows, infoSchemaGlobalVariablesQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaGlobalVariablesQuery, err)
+	}
+
+	s.export(rows, ch)
+	return nil
+}
+
+func (s *ScrapeGlobalVariables) export(rows []GlobalVariable, ch chan<- prometheus.Metric) {
+	// descs are shared by the nodes
+	descs := make(map[string]*prometheus.Desc)
+	for _, row := range rows {
+		nodeID := strconv.FormatInt(row.NodeID, 10)
+		name := invalidMetricNameRegexp.ReplaceAllString(strings.ToLower(row.VariableName), "_")
+
+		value, ok := parseStatusValue(row.VariableValue)
+		if !ok {
+			if s.allowed(name) {
+				ch <- prometheus.MustNewConstMetric(variableInfoDesc, prometheus.GaugeValue, 1, nodeID, name, row.VariableValue)
+			}
+			continue
+		}
+
+		desc, exists := descs[name]
+		if !exists {
+			desc = prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, globalVariables, name),
+				"Global variable "+row.VariableName,
+				[]string{"node_id"},
+				nil,
+			)
+			descs[name] = desc
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, nodeID)
+	}
+}
+
+func (s *ScrapeGlobalVariables) allowed(name string) bool {
+	for _, re := range s.InfoAllowlist {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeGlobalVariablesExport(t *testing.T) {
+	scraper := NewScrapeGlobalVariables([]*regexp.Regexp{regexp.MustCompile(`^(sql_mode|memsql_version)$`)})
+	rows := []GlobalVariable{
+		{NodeID: 1, VariableName: "maximum_memory", VariableValue: "65536"},
+		{NodeID: 2, VariableName: "maximum_memory", VariableValue: "32768"},
+		{NodeID: 1, VariableName: "sync_permissions", VariableValue: "ON"},
+		{NodeID: 1, VariableName: "memsql_version", VariableValue: "8.5.10"},
+		{NodeID: 1, VariableName: "sql_mode", VariableValue: "STRICT_ALL_TABLES"},
+		{NodeID: 1, VariableName: "collation_server", VariableValue: "utf8mb4_general_ci"},
+	}
+
+	ch := make(chan prometheus.Metric, len(rows))
+	scraper.export(rows, ch)
+
+	got := metricValues(t, drain(ch))
+
+	gauge := func(name string) string {
+		return prometheus.NewDesc("singlestore_global_variables_"+name, "Global variable "+name, []string{"node_id"}, nil).String()
+	}
+	assert.Equal(t, map[string]float64{
+		gauge("maximum_memory") + ",node_id=1":   65536,
+		gauge("maximum_memory") + ",node_id=2":   32768,
+		gauge("sync_permissions") + ",node_id=1": 1,
+		// version numbers are not numbers
+		variableInfoDesc.String() + ",name=memsql_version,node_id=1,value=8.5.10":      1,
+		variableInfoDesc.String() + ",name=sql_mode,node_id=1,value=STRICT_ALL_TABLES": 1,
+	}, got)
+}
@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"singlestore_exporter/log"
+	"singlestore_exporter/memsqlctl"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type MemoryStatus struct {
+	NodeID        int64  `db:"NODE_ID"`
+	VariableName  string `db:"VARIABLE_NAME"`
+	VariableValue string `db:"VARIABLE_VALUE"`
+}
+
+// ExtendedStatus is a row of SHOW STATUS EXTENDED run by memsqlctl
+type ExtendedStatus struct {
+	VariableName string `json:"Variable_name"`
+	Value        string `json:"Value"`
+}
+
+type MaximumMemory struct {
+	MaximumMemory string `json:"MAXIMUM_MEMORY"`
+}
+
+const (
+	memory = "memory"
+
+	// MemorySourceSQL reads the memory of every node of the cluster from the aggregator
+	MemorySourceSQL = "sql"
+	// MemorySourceMemsqlctl reads the memory of the nodes installed on the host of the exporter by memsqlctl
+	MemorySourceMemsqlctl = "memsqlctl"
+
+	infoSchemaMemoryStatusQuery = `SELECT NODE_ID, VARIABLE_NAME, NVL(VARIABLE_VALUE, '') AS VARIABLE_VALUE
+FROM information_schema.MV_GLOBAL_STATUS
+WHERE VARIABLE_NAME LIKE 'Alloc\_%' OR VARIABLE_NAME LIKE '%\_memory'
+UNION ALL
+SELECT NODE_ID, VARIABLE_NAME, NVL(VARIABLE_VALUE, '') AS VARIABLE_VALUE
+FROM information_schema.MV_GLOBAL_VARIABLES
+WHERE VARIABLE_NAME = 'maximum_memory'`
+
+	showStatusExtendedQuery = "SHOW STATUS EXTENDED"
+	maximumMemoryQuery      = "SELECT @@maximum_memory AS MAXIMUM_MEMORY"
+
+	totalServerMemory = "total_server_memory"
+	maximumMemory     = "maximum_memory"
+)
+
+var (
+	// node_id is empty for nodes which memsqlctl lists without an ID,
+	// memsql_id is empty for the nodes read from the aggregator
+	memoryTotalServerDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, memory, "total_server_bytes"),
+		"Memory used by the node, Total_server_memory",
+		[]string{"node_id", "memsql_id"},
+		nil,
+	)
+
+	memoryMaximumDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, memory, "maximum_bytes"),
+		"Memory the node may use, maximum_memory",
+		[]string{"node_id", "memsql_id"},
+		nil,
+	)
+
+	memoryUsedRatioDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, memory, "used_ratio"),
+		"Share of maximum_memory used by the node",
+		[]string{"node_id", "memsql_id"},
+		nil,
+	)
+
+	memoryAllocatedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, memory, "allocated_bytes"),
+		"Memory of the node by allocator, from the Alloc_* and *_memory status variables",
+		[]string{"node_id", "memsql_id", "name"},
+		nil,
+	)
+)
+
+// ScrapeMemory exports the memory of every node by allocator, from the aggregator,
+// or from the nodes on the host of the exporter by memsqlctl when there is no DSN, e.g. on leaf hosts.
+type ScrapeMemory struct {
+	Memsqlctl memsqlctl.Client
+	// Source is MemorySourceMemsqlctl or MemorySourceSQL
+	Source string
+}
+
+func NewScrapeMemory(client memsqlctl.Client, source string) *ScrapeMemory {
+	if source == "" {
+		source = MemorySourceSQL
+	}
+	return &ScrapeMemory{
+		Memsqlctl: client,
+		Source:    source,
+	}
+}
+
+func (s *ScrapeMemory) Name() string {
+	return "memory"
+}
+
+func (s *ScrapeMemory) Help() string {
+	return "Collect memory by allocator of every node"
+}
+
+func (s *ScrapeMemory) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if s.Source == MemorySourceMemsqlctl {
+		return s.scrapeMemsqlctl(ctx, ch)
+	}
+
+	if db == nil {
+		return errNoConnection
+	}
+
+	rows := make([]MemoryStatus, 0)
+	if err := db.SelectContext(ctx, &rows, infoSchemaMemoryStatusQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaMemoryStatusQuery, err)
+	}
+
+	nodes := make(map[int64]map[string]string)
+	for _, row := range rows {
+		if nodes[row.NodeID] == nil {
+			nodes[row.NodeID] = make(map[string]string)
+		}
+		nodes[row.NodeID][strings.ToLower(row.VariableName)] = row.VariableValue
+	}
+	for nodeID, variables := range nodes {
+		exportMemory(strconv.FormatInt(nodeID, 10), "", variables, ch)
+	}
+
+	return nil
+}
+
+func (s *ScrapeMemory) scrapeMemsqlctl(ctx context.Context, ch chan<- prometheus.Metric) error {
+	nodes, err := s.Memsqlctl.ListNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, node := range nodes {
+		variables, err := s.queryNode(ctx, node.MemsqlId)
+		if err != nil {
+			log.ErrorLogger.Errorf("memory of node failed: memsql_id=%s error=%v", node.MemsqlId, err)
+			failed++
+			continue
+		}
+
+		exportMemory(node.NodeID, node.MemsqlId, variables, ch)
+	}
+
+	if failed > 0 && failed == len(nodes) {
+		return fmt.Errorf("memory of every node failed: nodes=%d", failed)
+	}
+	return nil
+}
+
+func (s *ScrapeMemory) queryNode(ctx context.Context, memsqlID string) (map[string]string, error) {
+	status := make([]ExtendedStatus, 0)
+	if err := s.Memsqlctl.Query(ctx, memsqlID, showStatusExtendedQuery, &status); err != nil {
+		return nil, err
+	}
+	maximum := make([]MaximumMemory, 0)
+	if err := s.Memsqlctl.Query(ctx, memsqlID, maximumMemoryQuery, &maximum); err != nil {
+		return nil, err
+	}
+
+	variables := make(map[string]string, len(status)+1)
+	for _, row := range status {
+		variables[strings.ToLower(row.VariableName)] = row.Value
+	}
+	if len(maximum) > 0 {
+		variables[maximumMemory] = maximum[0].MaximumMemory
+	}
+	return variables, nil
+}
+
+// exportMemory exports the memory variables of a node, by lower case name
+func exportMemory(nodeID string, memsqlID string, variables map[string]string, ch chan<- prometheus.Metric) {
+	var total, maximum float64
+	for name, value := range variables {
+		bytes, ok := parseStatusValue(value)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == maximumMemory:
+			// in MB
+			maximum = bytes * (1 << 20)
+			ch <- prometheus.MustNewConstMetric(memoryMaximumDesc, prometheus.GaugeValue, maximum, nodeID, memsqlID)
+		case name == totalServerMemory:
+			total = bytes
+			ch <- prometheus.MustNewConstMetric(memoryTotalServerDesc, prometheus.GaugeValue, total, nodeID, memsqlID)
+		case isMemoryStatus(name):
+			ch <- prometheus.MustNewConstMetric(memoryAllocatedDesc, prometheus.GaugeValue, bytes, nodeID, memsqlID, name)
+		}
+	}
+
+	if maximum > 0 {
+		ch <- prometheus.MustNewConstMetric(memoryUsedRatioDesc, prometheus.GaugeValue, total/maximum, nodeID, memsqlID)
+	}
+}
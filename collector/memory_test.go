@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"singlestore_exporter/memsqlctl"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeMemoryMemsqlctl(t *testing.T) {
+	fake := &memsqlctl.Fake{
+		Nodes: []memsqlctl.Node{{MemsqlId: "A", NodeID: "3"}, {MemsqlId: "B", NodeID: "4"}, {MemsqlId: "C"}},
+		QueryFunc: func(memsqlID string, sql string) (string, error) {
+			if memsqlID == "B" {
+				return "", errors.New("node is down")
+			}
+			if sql == maximumMemoryQuery {
+				return `[{"MAXIMUM_MEMORY": "1000"}]`, nil
+			}
+			if memsqlID == "C" {
+				return `[{"Variable_name": "Total_server_memory", "Value": "250.0 (+0.0) MB"}]`, nil
+			}
+			return `[
+				{"Variable_name": "Total_server_memory", "Value": "500.0 (+1.0) MB"},
+				{"Variable_name": "Alloc_table_memory", "Value": "300.0 (+1.0) MB"},
+				{"Variable_name": "Buffer_manager_memory", "Value": "100.0 (+0.0) MB"},
+				{"Variable_name": "Threads_running", "Value": "1"}
+			]`, nil
+		},
+	}
+
+	metrics, err := collectMetrics(context.Background(), NewScrapeMemory(fake, MemorySourceMemsqlctl), nil)
+	assert.NoError(t, err)
+
+	got := metricValues(t, metrics)
+
+	mb := float64(1 << 20)
+	assert.Equal(t, map[string]float64{
+		memoryTotalServerDesc.String() + ",memsql_id=A,node_id=3":                          500 * mb,
+		memoryMaximumDesc.String() + ",memsql_id=A,node_id=3":                              1000 * mb,
+		memoryUsedRatioDesc.String() + ",memsql_id=A,node_id=3":                            0.5,
+		memoryAllocatedDesc.String() + ",memsql_id=A,name=alloc_table_memory,node_id=3":    300 * mb,
+		memoryAllocatedDesc.String() + ",memsql_id=A,name=buffer_manager_memory,node_id=3": 100 * mb,
+		// a node without an ID keeps node_id empty instead of mixing in its memsql ID
+		memoryTotalServerDesc.String() + ",memsql_id=C,node_id=": 250 * mb,
+		memoryMaximumDesc.String() + ",memsql_id=C,node_id=":     1000 * mb,
+		memoryUsedRatioDesc.String() + ",memsql_id=C,node_id=":   0.25,
+	}, got)
+
+	// every node failing fails the scrape
+	fake.Nodes = fake.Nodes[1:2]
+	_, err = collectMetrics(context.Background(), NewScrapeMemory(fake, MemorySourceMemsqlctl), nil)
+	assert.Error(t, err)
+}
+
+func TestScrapeMemorySQLWithoutConnection(t *testing.T) {
+	ch := make(chan prometheus.Metric, 1)
+	assert.ErrorIs(t, NewScrapeMemory(&memsqlctl.Fake{}, MemorySourceSQL).Scrape(context.Background(), nil, ch), errNoConnection)
+}
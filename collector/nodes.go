@@ -2,53 +2,98 @@ package collector
 
 import (
 	"context"
-	"encoding/json"
-	"os/exec"
+	"database/sql"
+	"fmt"
 	"strconv"
 
-	"singlestore_exporter/log"
+	"singlestore_exporter/memsqlctl"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-type Node struct {
-	MemsqlId      string `json:"memsqlId"`
-	Role          string `json:"role"`
-	Port          int    `json:"port"`
-	ProcessState  string `json:"processState"`
-	IsConnectable bool   `json:"isConnectable"`
-	Version       string `json:"version"`
-	RecoveryState string `json:"recoveryState"`
-	BindAddress   string `json:"bindAddress"`
-	NodeID        string `json:"nodeID"`
-}
-
-type Nodes struct {
-	Nodes []Node `json:"nodes"`
-}
-
 const (
 	node = "node"
+
+	// NodesSourceMemsqlctl lists the nodes installed on the host of the exporter
+	NodesSourceMemsqlctl = "memsqlctl"
+	// NodesSourceSQL lists every node of the cluster from the aggregator
+	NodesSourceSQL = "sql"
+
+	showLeavesQuery        = "SHOW LEAVES"
+	showAggregatorsQuery   = "SHOW AGGREGATORS"
+	infoSchemaMVNodesQuery = `SELECT ID, IP_ADDR, PORT, VERSION
+FROM information_schema.MV_NODES`
 )
 
 var (
 	nodeStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, node, "state"),
 		"The state of nodes",
-		[]string{"port", "role", "version", "process_state", "recovery_state", "memsql_id", "node_id"},
+		[]string{"port", "role", "version", "process_state", "recovery_state", "memsql_id", "node_id", "source", "host"},
 		nil,
 	)
 )
 
-type ScrapeNodes struct{}
+// Leaf is a row of SHOW LEAVES. Columns differ between versions, only these are read.
+type Leaf struct {
+	Host   string        `db:"Host"`
+	Port   int           `db:"Port"`
+	State  string        `db:"State"`
+	NodeID sql.NullInt64 `db:"NodeId"`
+}
+
+// Aggregator is a row of SHOW AGGREGATORS.
+type Aggregator struct {
+	Host             string        `db:"Host"`
+	Port             int           `db:"Port"`
+	State            string        `db:"State"`
+	MasterAggregator int           `db:"Master_Aggregator"`
+	NodeID           sql.NullInt64 `db:"NodeId"`
+}
+
+type MVNode struct {
+	ID      int64          `db:"ID"`
+	IPAddr  string         `db:"IP_ADDR"`
+	Port    int            `db:"PORT"`
+	Version sql.NullString `db:"VERSION"`
+}
+
+type ScrapeNodes struct {
+	Memsqlctl memsqlctl.Client
+	// Source is NodesSourceMemsqlctl or NodesSourceSQL
+	Source string
+}
+
+func NewScrapeNodes(client memsqlctl.Client, source string) *ScrapeNodes {
+	if source == "" {
+		source = NodesSourceMemsqlctl
+	}
+	return &ScrapeNodes{
+		Memsqlctl: client,
+		Source:    source,
+	}
+}
+
+func (s *ScrapeNodes) Name() string {
+	return "nodes"
+}
 
 func (s *ScrapeNodes) Help() string {
-	return "Collect node state by memsqlctl"
+	return "Collect node state by memsqlctl or SQL"
 }
 
-func (s *ScrapeNodes) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) {
-	errorMetric := func() {
+func (s *ScrapeNodes) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	var (
+		nodes []memsqlctl.Node
+		err   error
+	)
+	if s.Source == NodesSourceSQL {
+		nodes, err = s.listSQLNodes(ctx, db)
+	} else {
+		nodes, err = s.Memsqlctl.ListNodes(ctx)
+	}
+	if err != nil {
 		ch <- prometheus.MustNewConstMetric(
 			nodeStateDesc, prometheus.GaugeValue, float64(0),
 			"Unknown",
@@ -58,26 +103,16 @@ func (s *ScrapeNodes) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometh
 			"Unknown",
 			"Unknown",
 			"Unknown",
+			s.Source,
+			"",
 		)
+		return err
 	}
 
-	out, err := exec.CommandContext(ctx, "/usr/bin/memsqlctl", "list-nodes", "--json", "--yes").Output()
-	if err != nil {
-		log.ErrorLogger.Errorf("scraping command failed: command='/usr/bin/memsqlctl list-nodes --json --yes' error=%v", err)
-		errorMetric()
-		return
-	}
-
-	var nodes Nodes
-	if err := json.Unmarshal(out, &nodes); err != nil {
-		log.ErrorLogger.Errorf("unmarshal output failed: command='/usr/bin/memsqlctl list-nodes --json --yes' out=%s error=%v", string(out), err)
-		errorMetric()
-		return
-	}
-
-	for _, node := range nodes.Nodes {
+	for _, node := range nodes {
+		// memsqlctl reports the process, SQL the state of the node in the cluster
 		state := 0
-		if node.ProcessState == "Running" {
+		if node.ProcessState == "Running" || node.ProcessState == "online" {
 			state = 1
 		}
 
@@ -90,7 +125,77 @@ func (s *ScrapeNodes) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometh
 			node.RecoveryState,
 			node.MemsqlId,
 			node.NodeID,
+			s.Source,
+			node.Host,
 		)
+	}
+
+	return nil
+}
+
+// listSQLNodes lists the nodes of the cluster from the aggregator,
+// with the cluster state of the node, e.g. online or offline, as process state.
+func (s *ScrapeNodes) listSQLNodes(ctx context.Context, db *sqlx.DB) ([]memsqlctl.Node, error) {
+	if db == nil {
+		return nil, errNoConnection
+	}
+	// SHOW commands gain columns with new versions
+	unsafe := db.Unsafe()
 
+	leaves := make([]Leaf, 0)
+	if err := unsafe.SelectContext(ctx, &leaves, showLeavesQuery); err != nil {
+		return nil, fmt.Errorf("scraping query failed: query=%s error=%v", showLeavesQuery, err)
+	}
+	aggregators := make([]Aggregator, 0)
+	if err := unsafe.SelectContext(ctx, &aggregators, showAggregatorsQuery); err != nil {
+		return nil, fmt.Errorf("scraping query failed: query=%s error=%v", showAggregatorsQuery, err)
+	}
+	mvNodes := make([]MVNode, 0)
+	if err := db.SelectContext(ctx, &mvNodes, infoSchemaMVNodesQuery); err != nil {
+		return nil, fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaMVNodesQuery, err)
+	}
+
+	return mergeSQLNodes(leaves, aggregators, mvNodes), nil
+}
+
+// mergeSQLNodes takes roles and states from SHOW AGGREGATORS and SHOW LEAVES,
+// and versions from MV_NODES, matched by node ID or else by host and port.
+func mergeSQLNodes(leaves []Leaf, aggregators []Aggregator, mvNodes []MVNode) []memsqlctl.Node {
+	versionsByID := make(map[int64]string, len(mvNodes))
+	versionsByAddr := make(map[string]string, len(mvNodes))
+	for _, mvNode := range mvNodes {
+		versionsByID[mvNode.ID] = mvNode.Version.String
+		versionsByAddr[mvNode.IPAddr+":"+strconv.Itoa(mvNode.Port)] = mvNode.Version.String
+	}
+
+	sqlNode := func(host string, port int, nodeID sql.NullInt64, role string, state string) memsqlctl.Node {
+		node := memsqlctl.Node{
+			Host:         host,
+			Role:         role,
+			Port:         port,
+			ProcessState: state,
+			Version:      versionsByAddr[host+":"+strconv.Itoa(port)],
+		}
+		if nodeID.Valid {
+			node.NodeID = strconv.FormatInt(nodeID.Int64, 10)
+			if version, exists := versionsByID[nodeID.Int64]; exists {
+				node.Version = version
+			}
+		}
+		return node
+	}
+
+	nodes := make([]memsqlctl.Node, 0, len(aggregators)+len(leaves))
+	for _, aggregator := range aggregators {
+		// the roles of memsqlctl
+		role := "Aggregator"
+		if aggregator.MasterAggregator == 1 {
+			role = "Master"
+		}
+		nodes = append(nodes, sqlNode(aggregator.Host, aggregator.Port, aggregator.NodeID, role, aggregator.State))
+	}
+	for _, leaf := range leaves {
+		nodes = append(nodes, sqlNode(leaf.Host, leaf.Port, leaf.NodeID, "Leaf", leaf.State))
 	}
+	return nodes
 }
@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"singlestore_exporter/memsqlctl"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeSQLNodes(t *testing.T) {
+	id := func(id int64) sql.NullInt64 {
+		return sql.NullInt64{Int64: id, Valid: true}
+	}
+	version := sql.NullString{String: "8.5.10", Valid: true}
+
+	tt := []struct {
+		name        string
+		leaves      []Leaf
+		aggregators []Aggregator
+		mvNodes     []MVNode
+		expected    []memsqlctl.Node
+	}{
+		{
+			name: "roles and versions",
+			aggregators: []Aggregator{
+				{Host: "10.0.0.1", Port: 3306, State: "online", MasterAggregator: 1, NodeID: id(1)},
+				{Host: "10.0.0.2", Port: 3306, State: "online", NodeID: id(2)},
+			},
+			leaves: []Leaf{
+				{Host: "10.0.0.3", Port: 3307, State: "offline", NodeID: id(3)},
+			},
+			mvNodes: []MVNode{
+				{ID: 1, IPAddr: "10.0.0.1", Port: 3306, Version: version},
+				{ID: 2, IPAddr: "10.0.0.2", Port: 3306, Version: version},
+				{ID: 3, IPAddr: "10.0.0.3", Port: 3307, Version: version},
+			},
+			expected: []memsqlctl.Node{
+				{Host: "10.0.0.1", Role: "Master", Port: 3306, ProcessState: "online", Version: "8.5.10", NodeID: "1"},
+				{Host: "10.0.0.2", Role: "Aggregator", Port: 3306, ProcessState: "online", Version: "8.5.10", NodeID: "2"},
+				{Host: "10.0.0.3", Role: "Leaf", Port: 3307, ProcessState: "offline", Version: "8.5.10", NodeID: "3"},
+			},
+		},
+		{
+			name: "nodes without id are matched by host and port, and told apart by host",
+			leaves: []Leaf{
+				{Host: "10.0.0.3", Port: 3307, State: "online"},
+				{Host: "10.0.0.4", Port: 3307, State: "online"},
+			},
+			mvNodes: []MVNode{
+				{ID: 3, IPAddr: "10.0.0.3", Port: 3307, Version: version},
+			},
+			expected: []memsqlctl.Node{
+				{Host: "10.0.0.3", Role: "Leaf", Port: 3307, ProcessState: "online", Version: "8.5.10"},
+				{Host: "10.0.0.4", Role: "Leaf", Port: 3307, ProcessState: "online"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, mergeSQLNodes(tc.leaves, tc.aggregators, tc.mvNodes))
+		})
+	}
+}
+
+func TestScrapeNodes(t *testing.T) {
+	tt := []struct {
+		name           string
+		client         *memsqlctl.Fake
+		source         string
+		expectedErr    bool
+		expectedValue  float64
+		expectedLabels map[string]string
+	}{
+		{
+			name: "memsqlctl",
+			client: &memsqlctl.Fake{Nodes: []memsqlctl.Node{
+				{MemsqlId: "ABC", Role: "Leaf", Port: 3307, ProcessState: "Running", Version: "8.5.10", NodeID: "3"},
+			}},
+			expectedValue: 1,
+			expectedLabels: map[string]string{
+				"role": "Leaf", "port": "3307", "process_state": "Running", "memsql_id": "ABC", "source": "memsqlctl",
+			},
+		},
+		{
+			name:           "memsqlctl failure",
+			client:         &memsqlctl.Fake{ListNodesErr: errors.New("memsqlctl not found")},
+			expectedErr:    true,
+			expectedLabels: map[string]string{"role": "Unknown", "source": "memsqlctl"},
+		},
+		{
+			name:           "sql without connection",
+			client:         &memsqlctl.Fake{},
+			source:         NodesSourceSQL,
+			expectedErr:    true,
+			expectedLabels: map[string]string{"role": "Unknown", "source": "sql"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics, err := scrapeAll(NewScrapeNodes(tc.client, tc.source))
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, metrics, 1)
+
+			m := &dto.Metric{}
+			assert.NoError(t, metrics[0].Write(m))
+			assert.Equal(t, tc.expectedValue, m.GetGauge().GetValue())
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			for name, value := range tc.expectedLabels {
+				assert.Equal(t, value, labels[name], name)
+			}
+		})
+	}
+}
+
+func TestScrapeNodesSQL(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "mysql")
+
+	// the column sets of SingleStore 8.5, NodeId is NULL while a leaf is attaching
+	mock.ExpectQuery(showLeavesQuery).WillReturnRows(sqlmock.NewRows([]string{
+		"Host", "Port", "Availability_Group", "Pair_Host", "Pair_Port", "State", "Opened_Connections",
+		"Average_Roundtrip_Latency_ms", "NodeId", "Grace_Period_In_seconds",
+	}).
+		AddRow("10.0.0.3", 3307, 1, "10.0.0.4", 3307, "online", 2, "0.312", 3, nil).
+		AddRow("10.0.0.4", 3307, 2, "10.0.0.3", 3307, "attaching", 0, nil, nil, nil).
+		AddRow("10.0.0.5", 3307, 1, nil, nil, "attaching", 0, nil, nil, nil))
+	mock.ExpectQuery(showAggregatorsQuery).WillReturnRows(sqlmock.NewRows([]string{
+		"Host", "Port", "State", "Opened_Connections", "Average_Roundtrip_Latency_ms", "Master_Aggregator", "NodeId",
+	}).
+		AddRow("127.0.0.1", 3306, "online", 1, nil, 1, 1))
+	mock.ExpectQuery(infoSchemaMVNodesQuery).WillReturnRows(sqlmock.NewRows([]string{"ID", "IP_ADDR", "PORT", "VERSION"}).
+		AddRow(1, "127.0.0.1", 3306, "8.5.10").
+		AddRow(3, "10.0.0.3", 3307, "8.5.10"))
+
+	// a registry rejects label sets which are not unique, failing the whole /metrics
+	registry := prometheus.NewPedanticRegistry()
+	assert.NoError(t, registry.Register(collectorFunc(func(ch chan<- prometheus.Metric) {
+		assert.NoError(t, NewScrapeNodes(&memsqlctl.Fake{}, NodesSourceSQL).Scrape(context.Background(), db, ch))
+	})))
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Len(t, families, 1)
+	hosts := make(map[string]float64)
+	for _, m := range families[0].GetMetric() {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "host" {
+				hosts[label.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{"127.0.0.1": 1, "10.0.0.3": 1, "10.0.0.4": 0, "10.0.0.5": 0}, hosts)
+}
+
+// collectorFunc is an unchecked collector, which a registry still checks for duplicate series
+type collectorFunc func(ch chan<- prometheus.Metric)
+
+func (f collectorFunc) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f collectorFunc) Collect(ch chan<- prometheus.Metric) {
+	f(ch)
+}
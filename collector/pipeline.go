@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus"
 	"singlestore_exporter/log"
@@ -38,19 +39,22 @@ var (
 
 type ScrapePipeline struct{}
 
+func (s *ScrapePipeline) Name() string {
+	return "pipeline"
+}
+
 func (s *ScrapePipeline) Help() string {
 	return "Collect metrics from information_schema.PIPELINES"
 }
 
-func (s *ScrapePipeline) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) {
+func (s *ScrapePipeline) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
 	if db == nil {
-		return
+		return errNoConnection
 	}
 
 	rows := make([]PipelineState, 0)
 	if err := db.SelectContext(ctx, &rows, infoSchemaPipelineStateQuery); err != nil {
-		log.ErrorLogger.Errorf("scraping query failed: query=%s error=%v", infoSchemaPipelineStateQuery, err)
-		return
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaPipelineStateQuery, err)
 	}
 
 	for _, row := range rows {
@@ -65,4 +69,6 @@ func (s *ScrapePipeline) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prom
 			continue
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,391 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PlanCacheRow is a plan in the plan cache of the aggregator, with its cumulative statistics.
+type PlanCacheRow struct {
+	PlanID           int64   `db:"PLAN_ID"`
+	DatabaseName     string  `db:"DATABASE_NAME"`
+	QueryText        string  `db:"QUERY_TEXT"`
+	Commits          float64 `db:"COMMITS"`
+	Rollbacks        float64 `db:"ROLLBACKS"`
+	RowCount         float64 `db:"ROWCOUNT"`
+	ExecutionTimeMS  float64 `db:"EXECUTION_TIME"`
+	AverageMemoryUse float64 `db:"AVERAGE_MEMORY_USE"`
+}
+
+const (
+	planCache = "plancache"
+
+	// PlanCacheRanking* select the plans with their own series
+	PlanCacheRankingExecutionTime        = "execution_time"
+	PlanCacheRankingExecutions           = "executions"
+	PlanCacheRankingRows                 = "rows"
+	PlanCacheRankingAverageExecutionTime = "average_execution_time"
+	PlanCacheRankingMemory               = "memory"
+
+	// planCacheOther is the plan_id label of the plans beyond the top plans
+	planCacheOther = "other"
+
+	// planCacheTopPlanGrace is the number of scrapes a top plan keeps its place while it ranks lower
+	planCacheTopPlanGrace = 3
+
+	// planCacheQueryTextMax is the maximum length of the query label
+	planCacheQueryTextMax = 200
+
+	infoSchemaPlanCacheQuery = `SELECT
+    PLAN_ID,
+    NVL(DATABASE_NAME, '') AS DATABASE_NAME,
+    NVL(QUERY_TEXT, '') AS QUERY_TEXT,
+    NVL(COMMITS, 0) AS COMMITS,
+    NVL(ROLLBACKS, 0) AS ROLLBACKS,
+    NVL(ROWCOUNT, 0) AS ROWCOUNT,
+    NVL(EXECUTION_TIME, 0) AS EXECUTION_TIME,
+    NVL(AVERAGE_MEMORY_USE, 0) AS AVERAGE_MEMORY_USE
+FROM information_schema.PLANCACHE`
+)
+
+var (
+	planCacheLabels = []string{"database", "plan_id", "query"}
+
+	planCacheExecutionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, planCache, "executions_total"),
+		"Executions of the plan, committed or rolled back",
+		planCacheLabels,
+		nil,
+	)
+
+	planCacheExecutionSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, planCache, "execution_seconds_total"),
+		"Time spent executing the plan",
+		planCacheLabels,
+		nil,
+	)
+
+	planCacheRowsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, planCache, "rows_total"),
+		"Rows returned or affected by the plan",
+		planCacheLabels,
+		nil,
+	)
+
+	planCacheAverageExecutionSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, planCache, "average_execution_seconds"),
+		"Average execution time of the plan since it was compiled",
+		planCacheLabels,
+		nil,
+	)
+
+	planCacheAverageMemoryBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, planCache, "average_memory_bytes"),
+		"Average memory used by an execution of the plan",
+		planCacheLabels,
+		nil,
+	)
+
+	planCacheOtherPlansDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, planCache, "other_plans"),
+		"The number of plans in the plan cache which are summed up as plan_id=\"other\"",
+		nil,
+		nil,
+	)
+)
+
+// planValues are the cumulative statistics of a plan: executions, execution seconds and rows
+type planValues [3]float64
+
+func (r *PlanCacheRow) values() planValues {
+	return planValues{r.Commits + r.Rollbacks, r.ExecutionTimeMS / 1000, r.RowCount}
+}
+
+// memoryUse is the memory used by every execution of the plan, summed up
+func (r *PlanCacheRow) memoryUse() float64 {
+	return r.AverageMemoryUse * (r.Commits + r.Rollbacks)
+}
+
+func (r *PlanCacheRow) averageExecutionSeconds() float64 {
+	if executions := r.Commits + r.Rollbacks; executions > 0 {
+		return r.ExecutionTimeMS / 1000 / executions
+	}
+	return 0
+}
+
+type planKey struct {
+	planID       int64
+	databaseName string
+	queryText    string
+}
+
+func (r *PlanCacheRow) key() planKey {
+	return planKey{r.PlanID, r.DatabaseName, r.QueryText}
+}
+
+type topPlan struct {
+	// baseline are the values when the plan got its own series, which start from zero
+	baseline planValues
+	row      PlanCacheRow
+	// outside is the number of updates in a row the plan ranked outside of the top plans
+	outside int
+}
+
+// planCacheState re-ranks the plans on every update, and keeps a top plan for planCacheTopPlanGrace updates
+// after it dropped out of the ranking, so that its series are stable. The usage of the other plans since
+// the last scrape is summed up, so that "other" only goes up.
+type planCacheState struct {
+	initialized bool
+
+	previous map[planKey]planValues
+	// previousMemoryUse is the memory use of the plans at the last update, to rank by memory since then
+	previousMemoryUse map[planKey]float64
+	top               map[planKey]*topPlan
+	other             planValues
+	// otherPlans is the number of cached plans which are not top plans
+	otherPlans int
+}
+
+func newPlanCacheState() *planCacheState {
+	return &planCacheState{
+		previous:          make(map[planKey]planValues),
+		previousMemoryUse: make(map[planKey]float64),
+		top:               make(map[planKey]*topPlan),
+	}
+}
+
+// update re-ranks the plans and adds the usage of the plans without a series of their own to other.
+// The first update only takes the baseline, like the activities.
+func (s *planCacheState) update(rows []PlanCacheRow, topPlans int, ranking string) {
+	current := make(map[planKey]planValues, len(rows))
+	deltas := make(map[planKey]planValues, len(rows))
+	currentMemoryUse := make(map[planKey]float64, len(rows))
+	memoryDeltas := make(map[planKey]float64, len(rows))
+	wasTop := make(map[planKey]bool, len(s.top))
+	for _, row := range rows {
+		key := row.key()
+		values := row.values()
+		current[key] = values
+
+		currentMemoryUse[key] = row.memoryUse()
+
+		// usage of a plan compiled since the last scrape counts in full
+		delta := values
+		memoryDelta := row.memoryUse()
+		previous, exists := s.previous[key]
+		if exists && decreased(previous[:], values[:]) {
+			// a plan ID reused after the aggregator restarted
+			delete(s.top, key)
+			exists = false
+		}
+		if exists {
+			for i := range delta {
+				delta[i] -= previous[i]
+			}
+			// the average is rounded by the server, so the sum may go down a little
+			memoryDelta = math.Max(memoryDelta-s.previousMemoryUse[key], 0)
+		}
+		deltas[key] = delta
+		memoryDeltas[key] = memoryDelta
+
+		if top, isTop := s.top[key]; isTop {
+			top.row = row
+			wasTop[key] = true
+		}
+	}
+
+	// evicted plans give their place to others
+	for key := range s.top {
+		if _, exists := current[key]; !exists {
+			delete(s.top, key)
+		}
+	}
+
+	s.rank(rows, deltas, memoryDeltas, topPlans, ranking)
+
+	// the series of a plan cover its usage while it keeps its place, the rest is other
+	if s.initialized {
+		for key, delta := range deltas {
+			if _, isTop := s.top[key]; isTop && wasTop[key] {
+				continue
+			}
+			for i := range delta {
+				s.other[i] += delta[i]
+			}
+		}
+	}
+
+	s.previous = current
+	s.previousMemoryUse = currentMemoryUse
+	s.otherPlans = len(rows) - len(s.top)
+	s.initialized = true
+}
+
+// rank gives the plans ranked highest a place in the top plans, as places are given up
+// by the top plans which ranked lower for more than planCacheTopPlanGrace updates.
+func (s *planCacheState) rank(rows []PlanCacheRow, deltas map[planKey]planValues, memoryDeltas map[planKey]float64, topPlans int, ranking string) {
+	weights := make([]float64, len(rows))
+	order := make([]int, len(rows))
+	for i, row := range rows {
+		weights[i] = planWeight(row, deltas[row.key()], memoryDeltas[row.key()], s.initialized, ranking)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if weights[order[i]] != weights[order[j]] {
+			return weights[order[i]] > weights[order[j]]
+		}
+		return rows[order[i]].PlanID < rows[order[j]].PlanID
+	})
+
+	ranked := make(map[planKey]bool, topPlans)
+	for n, i := range order {
+		if n >= topPlans || weights[i] <= 0 {
+			break
+		}
+		ranked[rows[i].key()] = true
+	}
+
+	for key, top := range s.top {
+		if ranked[key] {
+			top.outside = 0
+			continue
+		}
+		top.outside++
+		if top.outside > planCacheTopPlanGrace {
+			delete(s.top, key)
+		}
+	}
+
+	// the lowest ranked top plans give up their place when topPlans was lowered by a reload
+	for n := len(order) - 1; n >= 0 && len(s.top) > topPlans; n-- {
+		delete(s.top, rows[order[n]].key())
+	}
+
+	for _, i := range order {
+		key := rows[i].key()
+		if len(s.top) >= topPlans || !ranked[key] {
+			break
+		}
+		if _, isTop := s.top[key]; !isTop {
+			s.top[key] = &topPlan{baseline: rows[i].values(), row: rows[i]}
+		}
+	}
+}
+
+// planWeight ranks a plan by its usage since the last scrape, or since the plan was compiled on the first scrape.
+// Averages are those of the executions since then, so a plan which was heavy long ago does not keep its place,
+// and a plan which was not executed since ranks last.
+func planWeight(row PlanCacheRow, delta planValues, memoryDelta float64, initialized bool, ranking string) float64 {
+	values := delta
+	if !initialized {
+		values = row.values()
+		memoryDelta = row.memoryUse()
+	}
+
+	switch ranking {
+	case PlanCacheRankingExecutions:
+		return values[0]
+	case PlanCacheRankingRows:
+		return values[2]
+	case PlanCacheRankingAverageExecutionTime:
+		if values[0] <= 0 {
+			return 0
+		}
+		return values[1] / values[0]
+	case PlanCacheRankingMemory:
+		if values[0] <= 0 {
+			return 0
+		}
+		return memoryDelta / values[0]
+	default:
+		return values[1]
+	}
+}
+
+func (s *planCacheState) metrics() []prometheus.Metric {
+	metrics := make([]prometheus.Metric, 0, len(s.top)*5+4)
+	for _, top := range s.top {
+		labels := []string{top.row.DatabaseName, strconv.FormatInt(top.row.PlanID, 10), planQueryLabel(top.row.QueryText)}
+		values := top.row.values()
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(planCacheExecutionsDesc, prometheus.CounterValue, values[0]-top.baseline[0], labels...),
+			prometheus.MustNewConstMetric(planCacheExecutionSecondsDesc, prometheus.CounterValue, values[1]-top.baseline[1], labels...),
+			prometheus.MustNewConstMetric(planCacheRowsDesc, prometheus.CounterValue, values[2]-top.baseline[2], labels...),
+			prometheus.MustNewConstMetric(planCacheAverageExecutionSecondsDesc, prometheus.GaugeValue, top.row.averageExecutionSeconds(), labels...),
+			prometheus.MustNewConstMetric(planCacheAverageMemoryBytesDesc, prometheus.GaugeValue, top.row.AverageMemoryUse, labels...),
+		)
+	}
+
+	// averages can not be summed up, other only has the counters
+	labels := []string{"", planCacheOther, ""}
+	metrics = append(metrics,
+		prometheus.MustNewConstMetric(planCacheExecutionsDesc, prometheus.CounterValue, s.other[0], labels...),
+		prometheus.MustNewConstMetric(planCacheExecutionSecondsDesc, prometheus.CounterValue, s.other[1], labels...),
+		prometheus.MustNewConstMetric(planCacheRowsDesc, prometheus.CounterValue, s.other[2], labels...),
+		prometheus.MustNewConstMetric(planCacheOtherPlansDesc, prometheus.GaugeValue, float64(s.otherPlans)),
+	)
+	return metrics
+}
+
+// planQueryLabel collapses the whitespace of a query and cuts it to planCacheQueryTextMax runes
+func planQueryLabel(queryText string) string {
+	query := strings.Join(strings.Fields(queryText), " ")
+	if runes := []rune(query); len(runes) > planCacheQueryTextMax {
+		query = string(runes[:planCacheQueryTextMax]) + "..."
+	}
+	return query
+}
+
+// ScrapePlanCache exports the statistics of the top plans of the plan cache of the aggregator,
+// and sums up the others as plan_id="other", because the plan cache holds thousands of plans.
+type ScrapePlanCache struct {
+	// TopPlans is the number of plans with their own series
+	TopPlans int
+	// Ranking is one of PlanCacheRanking*, execution time when empty
+	Ranking string
+
+	states *targetStates[planCacheState]
+}
+
+func NewScrapePlanCache(topPlans int, ranking string, states *ScraperStates) *ScrapePlanCache {
+	return &ScrapePlanCache{
+		TopPlans: topPlans,
+		Ranking:  ranking,
+		states:   states.planCache,
+	}
+}
+
+func (s *ScrapePlanCache) Name() string {
+	return "plancache"
+}
+
+func (s *ScrapePlanCache) Help() string {
+	return "Collect statistics of the top plans from information_schema.PLANCACHE"
+}
+
+func (s *ScrapePlanCache) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if db == nil {
+		return errNoConnection
+	}
+
+	rows := make([]PlanCacheRow, 0)
+	if err := db.SelectContext(ctx, &rows, infoSchemaPlanCacheQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaPlanCacheQuery, err)
+	}
+
+	metrics := s.states.update(ctx, func(state *planCacheState) []prometheus.Metric {
+		state.update(rows, s.TopPlans, s.Ranking)
+		return state.metrics()
+	})
+	for _, metric := range metrics {
+		ch <- metric
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanCacheState(t *testing.T) {
+	plan := func(id int64, executions float64, executionTimeMS float64) PlanCacheRow {
+		return PlanCacheRow{PlanID: id, DatabaseName: "db", QueryText: "SELECT ?", Commits: executions, ExecutionTimeMS: executionTimeMS}
+	}
+	memoryPlan := func(id int64, executions float64, averageMemoryUse float64) PlanCacheRow {
+		return PlanCacheRow{PlanID: id, DatabaseName: "db", QueryText: "SELECT ?", Commits: executions, AverageMemoryUse: averageMemoryUse}
+	}
+	executions := func(s *planCacheState) map[int64]float64 {
+		result := make(map[int64]float64)
+		for key, top := range s.top {
+			result[key.planID] = top.row.values()[0] - top.baseline[0]
+		}
+		return result
+	}
+
+	tt := []struct {
+		name               string
+		topPlans           int
+		ranking            string
+		scrapes            [][]PlanCacheRow
+		expectedTop        map[int64]float64
+		expectedOther      float64
+		expectedOtherPlans int
+	}{
+		{
+			name:     "top plans by execution time, the others are summed up",
+			topPlans: 1,
+			scrapes: [][]PlanCacheRow{
+				{plan(1, 10, 100), plan(2, 10, 5000)},
+				{plan(1, 15, 200), plan(2, 12, 6000), plan(3, 4, 10)},
+			},
+			expectedTop:        map[int64]float64{2: 2},
+			expectedOther:      5 + 4,
+			expectedOtherPlans: 2,
+		},
+		{
+			name:     "ranking by the average execution time since the last scrape",
+			topPlans: 1,
+			ranking:  PlanCacheRankingAverageExecutionTime,
+			scrapes: [][]PlanCacheRow{
+				// plan 1 was slow long ago, plan 2 is slow now
+				{plan(1, 10, 100000), plan(2, 1, 500)},
+				{plan(1, 20, 101000), plan(2, 2, 3000)},
+				{plan(1, 30, 102000), plan(2, 3, 5500)},
+				{plan(1, 40, 103000), plan(2, 4, 8000)},
+				{plan(1, 50, 104000), plan(2, 5, 10500)},
+			},
+			expectedTop:        map[int64]float64{2: 0},
+			expectedOther:      4 + 10,
+			expectedOtherPlans: 1,
+		},
+		{
+			name:     "ranking by the average memory since the last scrape",
+			topPlans: 1,
+			ranking:  PlanCacheRankingMemory,
+			scrapes: [][]PlanCacheRow{
+				// every execution of plan 1 uses 100 after the first ones, and of plan 2 500
+				{memoryPlan(1, 10, 1000), memoryPlan(2, 1, 100)},
+				{memoryPlan(1, 20, 505), memoryPlan(2, 2, 300)},
+				{memoryPlan(1, 30, 340), memoryPlan(2, 3, 1100.0/3)},
+				{memoryPlan(1, 40, 257.5), memoryPlan(2, 4, 400)},
+				{memoryPlan(1, 50, 208), memoryPlan(2, 5, 420)},
+			},
+			expectedTop:        map[int64]float64{2: 0},
+			expectedOther:      4 + 10,
+			expectedOtherPlans: 1,
+		},
+		{
+			name:     "ranking by executions",
+			topPlans: 1,
+			ranking:  PlanCacheRankingExecutions,
+			scrapes: [][]PlanCacheRow{
+				{plan(1, 10, 100), plan(2, 5, 5000)},
+				{plan(1, 11, 100), plan(2, 5, 5000)},
+			},
+			expectedTop:        map[int64]float64{1: 1},
+			expectedOtherPlans: 1,
+		},
+		{
+			name:     "evicted plans give their place to others",
+			topPlans: 1,
+			scrapes: [][]PlanCacheRow{
+				{plan(1, 10, 100), plan(2, 10, 50)},
+				{plan(2, 15, 60)},
+				{plan(2, 17, 70)},
+			},
+			// the usage of plan 2 before it got its place is in other
+			expectedTop:   map[int64]float64{2: 2},
+			expectedOther: 5,
+		},
+		{
+			name:     "top plans keep their place while they rank lower for a few scrapes",
+			topPlans: 1,
+			scrapes: [][]PlanCacheRow{
+				{plan(1, 10, 1000), plan(2, 10, 100)},
+				{plan(1, 11, 1100), plan(2, 11, 600)},
+				{plan(1, 12, 1200), plan(2, 12, 1100)},
+				{plan(1, 13, 1300), plan(2, 13, 1600)},
+			},
+			expectedTop:        map[int64]float64{1: 3},
+			expectedOther:      3,
+			expectedOtherPlans: 1,
+		},
+		{
+			name:     "top plans ranking lower for too long give their place to others",
+			topPlans: 1,
+			scrapes: [][]PlanCacheRow{
+				{plan(1, 10, 1000), plan(2, 10, 100)},
+				{plan(1, 11, 1100), plan(2, 11, 600)},
+				{plan(1, 12, 1200), plan(2, 12, 1100)},
+				{plan(1, 13, 1300), plan(2, 13, 1600)},
+				{plan(1, 14, 1400), plan(2, 14, 2100)},
+				{plan(1, 15, 1500), plan(2, 15, 2600)},
+			},
+			// plan 1 since it gave up its place, plan 2 until it got it
+			expectedTop:        map[int64]float64{2: 1},
+			expectedOther:      2 + 4,
+			expectedOtherPlans: 1,
+		},
+		{
+			name:     "plans compiled since the last scrape count in full",
+			topPlans: 0,
+			scrapes: [][]PlanCacheRow{
+				{plan(1, 10, 100)},
+				{plan(1, 10, 100), plan(2, 3, 10)},
+			},
+			expectedTop:        map[int64]float64{},
+			expectedOther:      3,
+			expectedOtherPlans: 2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newPlanCacheState()
+			for _, rows := range tc.scrapes {
+				s.update(rows, tc.topPlans, tc.ranking)
+			}
+			assert.Equal(t, tc.expectedTop, executions(s))
+			assert.Equal(t, tc.expectedOther, s.other[0])
+			assert.Equal(t, tc.expectedOtherPlans, s.otherPlans)
+		})
+	}
+}
+
+func TestPlanQueryLabel(t *testing.T) {
+	assert.Equal(t, "SELECT a FROM t WHERE b = ?", planQueryLabel("SELECT a\n  FROM t\tWHERE b = ?"))
+	assert.Equal(t, strings.Repeat("x", planCacheQueryTextMax)+"...", planQueryLabel(strings.Repeat("x", planCacheQueryTextMax+1)))
+}
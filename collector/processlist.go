@@ -3,6 +3,10 @@ package collector
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
 	"time"
 
 	"singlestore_exporter/log"
@@ -61,44 +65,157 @@ var (
 	)
 )
 
-type ScrapeProcessList struct {
-	Threshold int
-	Query     string
+// ProcessFilter excludes processes from the slow query metrics.
+// It is applied in Go on the fetched rows, so none of its values ever becomes part of the SQL text.
+type ProcessFilter struct {
+	// Hosts excludes clients connecting from hosts matching these SQL LIKE patterns, e.g. 10.0.%,
+	// compared with HOST without the port and the brackets of IPv6 addresses, ignoring case
+	Hosts []string
+	// InfoPatterns excludes queries containing one of these SQL LIKE patterns, ignoring case,
+	// as if matched with LIKE '%pattern%'
+	InfoPatterns []string
+	// InfoRegexps excludes queries matching one of these expressions
+	InfoRegexps []*regexp.Regexp
+	// Users, DBs, Commands and ResourcePools exclude processes equal to one of their values.
+	// Commands ignore case.
+	Users         []string
+	DBs           []string
+	Commands      []string
+	ResourcePools []string
+}
+
+// Excludes tells whether process must not be counted as a slow query.
+// INFO is truncated by the query, so patterns are only matched against its first 1000 characters.
+func (f *ProcessFilter) Excludes(process *Process) bool {
+	host := clientHost(process.Host)
+	for _, pattern := range f.Hosts {
+		if likeMatch(pattern, host) {
+			return true
+		}
+	}
+
+	info := StringOrEmpty(process.Info)
+	for _, pattern := range f.InfoPatterns {
+		if likeMatch("%"+pattern+"%", info) {
+			return true
+		}
+	}
+	for _, re := range f.InfoRegexps {
+		if re.MatchString(info) {
+			return true
+		}
+	}
+
+	for _, user := range f.Users {
+		if process.User == user {
+			return true
+		}
+	}
+	for _, db := range f.DBs {
+		if process.DB.Valid && process.DB.String == db {
+			return true
+		}
+	}
+	for _, command := range f.Commands {
+		if strings.EqualFold(process.Command, command) {
+			return true
+		}
+	}
+	for _, pool := range f.ResourcePools {
+		if process.ResourcePool.Valid && process.ResourcePool.String == pool {
+			return true
+		}
+	}
+	return false
 }
 
-func NewScrapeProcessList(threshold int, exceptionHosts []string, exceptionInfoPatterns []string) *ScrapeProcessList {
-	query := infoSchemaProcessListQuery
-	if len(exceptionHosts) != 0 || len(exceptionInfoPatterns) != 0 {
-		query += "\nWHERE "
+// clientHost strips the port from HOST, e.g. 10.0.0.1:5000 or [::1]:5000, and the brackets of IPv6 addresses
+func clientHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
 	}
-	for _, host := range exceptionHosts {
-		query += "HOST NOT LIKE '" + host + ":%' AND "
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
 	}
-	for _, pattern := range exceptionInfoPatterns {
-		query += "NVL(INFO, '') NOT LIKE '%" + pattern + "%' AND "
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		return host[:i]
 	}
-	if len(exceptionHosts) != 0 || len(exceptionInfoPatterns) != 0 {
-		query = query[:len(query)-5]
+	return host
+}
+
+// likeMatch tells whether s matches the SQL LIKE pattern, ignoring case like the default collation.
+// % matches any characters, _ a single character, and \ escapes them and itself.
+// A backslash before any other character is compared literally, e.g. in C:\tmp.
+func likeMatch(pattern string, s string) bool {
+	p := []rune(strings.ToLower(pattern))
+	r := []rune(strings.ToLower(s))
+
+	pi, ri := 0, 0
+	// the last % and the position of s it was matched at, to backtrack to
+	starP, starR := -1, 0
+	for ri < len(r) {
+		if pi < len(p) {
+			switch {
+			case p[pi] == '%':
+				starP, starR = pi, ri
+				pi++
+				continue
+			case p[pi] == '_':
+				pi++
+				ri++
+				continue
+			case p[pi] == '\\' && pi+1 < len(p) && (p[pi+1] == '%' || p[pi+1] == '_' || p[pi+1] == '\\'):
+				if p[pi+1] == r[ri] {
+					pi += 2
+					ri++
+					continue
+				}
+			case p[pi] == r[ri]:
+				pi++
+				ri++
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starR++
+		pi, ri = starP+1, starR
 	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+type ScrapeProcessList struct {
+	Threshold int
+	Filter    ProcessFilter
+}
+
+func NewScrapeProcessList(threshold int, filter ProcessFilter) *ScrapeProcessList {
 	return &ScrapeProcessList{
 		Threshold: threshold,
-		Query:     query,
+		Filter:    filter,
 	}
 }
 
+func (s *ScrapeProcessList) Name() string {
+	return "slow_query"
+}
+
 func (s *ScrapeProcessList) Help() string {
 	return "Collect metrics from information_schema.PROCESSLIST"
 }
 
-func (s *ScrapeProcessList) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) {
+func (s *ScrapeProcessList) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
 	if db == nil {
-		return
+		return errNoConnection
 	}
 
 	processList := make([]Process, 0)
-	if err := db.SelectContext(ctx, &processList, s.Query); err != nil {
-		log.ErrorLogger.Errorf("scraping query failed: query=%s error=%v", s.Query, err)
-		return
+	if err := db.SelectContext(ctx, &processList, infoSchemaProcessListQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaProcessListQuery, err)
 	}
 
 	maxTime := make(map[string]int)
@@ -110,6 +227,8 @@ func (s *ScrapeProcessList) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- p
 			continue
 		} else if process.Time < s.Threshold {
 			continue
+		} else if s.Filter.Excludes(&process) {
+			continue
 		}
 
 		if m, exists := maxTime[process.User]; !exists {
@@ -147,6 +266,8 @@ func (s *ScrapeProcessList) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- p
 			user,
 		)
 	}
+
+	return nil
 }
 
 func StringOrEmpty(str sql.NullString) string {
@@ -1,58 +1,215 @@
 package collector
 
 import (
+	"database/sql"
 	"github.com/stretchr/testify/assert"
+	"regexp"
 	"testing"
 )
 
 func TestNewScrapeProcessList(t *testing.T) {
 	tt := []struct {
 		threshold         int
-		hosts             []string
-		infoPatterns      []string
+		filter            ProcessFilter
 		expectedThreshold int
-		expectedQuery     string
 	}{
 		{
 			threshold:         1,
+			filter:            ProcessFilter{},
 			expectedThreshold: 1,
-			hosts:             []string{},
-			infoPatterns:      []string{},
-			expectedQuery: `SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, LEFT(INFO, 1000) AS INFO, RPC_INFO, PLAN_ID, TRANSACTION_STATE, ROW_LOCKS_HELD, PARTITION_LOCKS_HELD, EPOCH, LWPID, RESOURCE_POOL, STMT_VERSION, REASON_FOR_QUEUEING, DATE_SUB(now(), INTERVAL time SECOND) AS SUBMITTED_TIME
-FROM information_schema.PROCESSLIST`,
 		},
 		{
 			threshold:         2,
+			filter:            ProcessFilter{Hosts: []string{"host1", "host2"}},
 			expectedThreshold: 2,
-			hosts:             []string{"host1", "host2"},
-			infoPatterns:      []string{},
-			expectedQuery: `SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, LEFT(INFO, 1000) AS INFO, RPC_INFO, PLAN_ID, TRANSACTION_STATE, ROW_LOCKS_HELD, PARTITION_LOCKS_HELD, EPOCH, LWPID, RESOURCE_POOL, STMT_VERSION, REASON_FOR_QUEUEING, DATE_SUB(now(), INTERVAL time SECOND) AS SUBMITTED_TIME
-FROM information_schema.PROCESSLIST
-WHERE HOST NOT LIKE 'host1:%' AND HOST NOT LIKE 'host2:%'`,
 		},
 		{
 			threshold:         3,
+			filter:            ProcessFilter{InfoPatterns: []string{"pattern1", "pattern2"}},
 			expectedThreshold: 3,
-			hosts:             []string{},
-			infoPatterns:      []string{"pattern1", "pattern2"},
-			expectedQuery: `SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, LEFT(INFO, 1000) AS INFO, RPC_INFO, PLAN_ID, TRANSACTION_STATE, ROW_LOCKS_HELD, PARTITION_LOCKS_HELD, EPOCH, LWPID, RESOURCE_POOL, STMT_VERSION, REASON_FOR_QUEUEING, DATE_SUB(now(), INTERVAL time SECOND) AS SUBMITTED_TIME
-FROM information_schema.PROCESSLIST
-WHERE NVL(INFO, '') NOT LIKE '%pattern1%' AND NVL(INFO, '') NOT LIKE '%pattern2%'`,
+		},
+	}
+
+	for _, tc := range tt {
+		scraper := NewScrapeProcessList(tc.threshold, tc.filter)
+		assert.Equal(t, tc.expectedThreshold, scraper.Threshold)
+		assert.Equal(t, tc.filter, scraper.Filter)
+	}
+}
+
+func TestProcessFilterExcludes(t *testing.T) {
+	process := func(user string, host string, db string, command string, info string, pool string) *Process {
+		return &Process{
+			User:         user,
+			Host:         host,
+			DB:           sql.NullString{String: db, Valid: db != ""},
+			Command:      command,
+			Info:         sql.NullString{String: info, Valid: info != ""},
+			ResourcePool: sql.NullString{String: pool, Valid: pool != ""},
+		}
+	}
+
+	tt := []struct {
+		name     string
+		filter   ProcessFilter
+		process  *Process
+		expected bool
+	}{
+		{
+			name:     "empty filter excludes nothing",
+			filter:   ProcessFilter{},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 1", "default_pool"),
+			expected: false,
+		},
+		{
+			name:     "host without its port",
+			filter:   ProcessFilter{Hosts: []string{"localhost"}},
+			process:  process("app", "localhost:41234", "db", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "host ignores case",
+			filter:   ProcessFilter{Hosts: []string{"LOCALHOST"}},
+			process:  process("app", "localhost:41234", "db", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "host is not a prefix match",
+			filter:   ProcessFilter{Hosts: []string{"10.0.0.1"}},
+			process:  process("app", "10.0.0.10:5000", "db", "Query", "SELECT 1", ""),
+			expected: false,
+		},
+		{
+			name:     "host matches a LIKE pattern",
+			filter:   ProcessFilter{Hosts: []string{"10.0.%"}},
+			process:  process("app", "10.0.3.7:5000", "db", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "underscore matches a single character",
+			filter:   ProcessFilter{Hosts: []string{"10.0.0._"}},
+			process:  process("app", "10.0.0.10:5000", "db", "Query", "SELECT 1", ""),
+			expected: false,
+		},
+		{
+			name:     "escaped wildcard is compared literally",
+			filter:   ProcessFilter{Hosts: []string{`web\_1`}},
+			process:  process("app", "webx1:5000", "db", "Query", "SELECT 1", ""),
+			expected: false,
+		},
+		{
+			name:     "bracketed IPv6 host matches without the brackets",
+			filter:   ProcessFilter{Hosts: []string{"::1"}},
+			process:  process("app", "[::1]:5000", "db", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "host with a quote is compared literally",
+			filter:   ProcessFilter{Hosts: []string{"x' OR '1'='1"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 1", ""),
+			expected: false,
+		},
+		{
+			name:     "percent matches every host",
+			filter:   ProcessFilter{Hosts: []string{"%"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "info pattern ignores case",
+			filter:   ProcessFilter{InfoPatterns: []string{"foreground"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "/* FOREGROUND */ SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "info pattern with quotes and comments",
+			filter:   ProcessFilter{InfoPatterns: []string{"'; DROP TABLE t; --"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT '; drop table t; --'", ""),
+			expected: true,
+		},
+		{
+			name:     "info pattern with LIKE wildcards",
+			filter:   ProcessFilter{InfoPatterns: []string{"100%_done"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 1000_done", ""),
+			expected: true,
+		},
+		{
+			name:     "info pattern with escaped LIKE wildcards",
+			filter:   ProcessFilter{InfoPatterns: []string{`100\%`}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 1000", ""),
+			expected: false,
+		},
+		{
+			name:     "info pattern with a backslash",
+			filter:   ProcessFilter{InfoPatterns: []string{`C:\tmp`}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", `LOAD DATA INFILE 'C:\tmp\x.csv'`, ""),
+			expected: true,
+		},
+		{
+			name:     "info pattern does not match a NULL info",
+			filter:   ProcessFilter{InfoPatterns: []string{"SELECT"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "", ""),
+			expected: false,
+		},
+		{
+			name:     "info regexp",
+			filter:   ProcessFilter{InfoRegexps: []*regexp.Regexp{regexp.MustCompile(`^(?i)select .* from backup_\w+`)}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT * FROM backup_2024", ""),
+			expected: true,
 		},
 		{
-			threshold:         4,
-			expectedThreshold: 4,
-			hosts:             []string{"host1", "host2"},
-			infoPatterns:      []string{"pattern1", "pattern2"},
-			expectedQuery: `SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, LEFT(INFO, 1000) AS INFO, RPC_INFO, PLAN_ID, TRANSACTION_STATE, ROW_LOCKS_HELD, PARTITION_LOCKS_HELD, EPOCH, LWPID, RESOURCE_POOL, STMT_VERSION, REASON_FOR_QUEUEING, DATE_SUB(now(), INTERVAL time SECOND) AS SUBMITTED_TIME
-FROM information_schema.PROCESSLIST
-WHERE HOST NOT LIKE 'host1:%' AND HOST NOT LIKE 'host2:%' AND NVL(INFO, '') NOT LIKE '%pattern1%' AND NVL(INFO, '') NOT LIKE '%pattern2%'`,
+			name:     "info regexp which does not match",
+			filter:   ProcessFilter{InfoRegexps: []*regexp.Regexp{regexp.MustCompile(`^INSERT`)}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 'INSERT'", ""),
+			expected: false,
+		},
+		{
+			name:     "user",
+			filter:   ProcessFilter{Users: []string{"backup"}},
+			process:  process("backup", "10.0.0.1:5000", "db", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "user with a quote",
+			filter:   ProcessFilter{Users: []string{"o'brien"}},
+			process:  process("o'brien", "10.0.0.1:5000", "db", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "db",
+			filter:   ProcessFilter{DBs: []string{"analytics"}},
+			process:  process("app", "10.0.0.1:5000", "analytics", "Query", "SELECT 1", ""),
+			expected: true,
+		},
+		{
+			name:     "db does not match a NULL db",
+			filter:   ProcessFilter{DBs: []string{""}},
+			process:  process("app", "10.0.0.1:5000", "", "Query", "SELECT 1", ""),
+			expected: false,
+		},
+		{
+			name:     "command ignores case",
+			filter:   ProcessFilter{Commands: []string{"binlog dump"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Binlog Dump", "", ""),
+			expected: true,
+		},
+		{
+			name:     "resource pool",
+			filter:   ProcessFilter{ResourcePools: []string{"batch"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 1", "batch"),
+			expected: true,
+		},
+		{
+			name:     "resource pool of another process",
+			filter:   ProcessFilter{ResourcePools: []string{"batch"}},
+			process:  process("app", "10.0.0.1:5000", "db", "Query", "SELECT 1", "default_pool"),
+			expected: false,
 		},
 	}
 
 	for _, tc := range tt {
-		scraper := NewScrapeProcessList(tc.threshold, tc.hosts, tc.infoPatterns)
-		assert.Equal(t, tc.expectedThreshold, scraper.Threshold)
-		assert.Equal(t, tc.expectedQuery, scraper.Query)
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.filter.Excludes(tc.process))
+		})
 	}
 }
@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"regexp"
+	"time"
+
+	"singlestore_exporter/memsqlctl"
+)
+
+// ScraperOptions holds the settings of scrapers which need more than an on/off switch.
+type ScraperOptions struct {
+	// Memsqlctl is shared by the node-local scrapers, so that they share its list-nodes inventory
+	Memsqlctl memsqlctl.Client
+
+	// NodesSource is NodesSourceMemsqlctl or NodesSourceSQL, memsqlctl when empty
+	NodesSource string
+	// MemorySource is MemorySourceMemsqlctl or MemorySourceSQL, sql when empty
+	MemorySource string
+
+	SlowQueryThreshold int
+	SlowQueryFilter    ProcessFilter
+
+	DataDiskUsageParallelism    int
+	DataDiskUsageCommandTimeout time.Duration
+
+	ActivitiesTopQueries int
+
+	PlanCacheTopPlans int
+	PlanCacheRanking  string
+
+	GlobalStatusAllowlist []*regexp.Regexp
+
+	GlobalVariablesInfoAllowlist []*regexp.Regexp
+
+	// States keeps the state of the stateful scrapers across reloads, a new one is used when nil
+	States *ScraperStates
+}
+
+type Registration struct {
+	Scraper Scraper
+
+	// RequiresDSN is set for scrapers which query the aggregator. They are skipped when no DSN is configured.
+	RequiresDSN bool
+
+	// NodeLocal is set for scrapers which inspect the host the exporter runs on, e.g. by memsqlctl.
+	// They are excluded from /probe scrapes of remote clusters.
+	NodeLocal bool
+
+	// EnabledByDefault is the default value of the --collect.<name> flag.
+	EnabledByDefault bool
+
+	// Timeout limits a single scrape of the scraper. Zero means it is only limited by the scrape timeout.
+	Timeout time.Duration
+}
+
+// Registry returns every scraper known to the exporter, built with opts.
+// To add a collector, implement Scraper and append it here.
+func Registry(opts *ScraperOptions) []Registration {
+	// from SQL, nodes lists the whole cluster like any other collector of the aggregator
+	nodesBySQL := opts.NodesSource == NodesSourceSQL
+	memoryByMemsqlctl := opts.MemorySource == MemorySourceMemsqlctl
+	states := opts.States
+	if states == nil {
+		states = NewScraperStates()
+	}
+
+	return []Registration{
+		{
+			Scraper:          NewScrapeNodes(opts.Memsqlctl, opts.NodesSource),
+			RequiresDSN:      nodesBySQL,
+			NodeLocal:        !nodesBySQL,
+			EnabledByDefault: true,
+		},
+		{
+			Scraper:          &ScrapeCachedBlobs{},
+			RequiresDSN:      true,
+			EnabledByDefault: true,
+		},
+		{
+			Scraper:          &ScrapePipeline{},
+			RequiresDSN:      true,
+			EnabledByDefault: true,
+		},
+		{
+			Scraper:          NewScrapeProcessList(opts.SlowQueryThreshold, opts.SlowQueryFilter),
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          &ScrapeReplicationStatus{},
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          &ScrapeActiveTransactions{},
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          NewScrapeActivities(opts.ActivitiesTopQueries, states),
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          NewScrapePlanCache(opts.PlanCacheTopPlans, opts.PlanCacheRanking, states),
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          NewScrapeGlobalStatus(opts.GlobalStatusAllowlist),
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          NewScrapeGlobalVariables(opts.GlobalVariablesInfoAllowlist),
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          &ScrapeResourcePool{},
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          &ScrapeSysinfo{},
+			RequiresDSN:      true,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          NewScrapeMemory(opts.Memsqlctl, opts.MemorySource),
+			RequiresDSN:      !memoryByMemsqlctl,
+			NodeLocal:        memoryByMemsqlctl,
+			EnabledByDefault: false,
+		},
+		{
+			Scraper:          NewScrapeDataDiskUsage(opts.Memsqlctl, opts.DataDiskUsageParallelism, opts.DataDiskUsageCommandTimeout, states),
+			RequiresDSN:      false,
+			NodeLocal:        true,
+			EnabledByDefault: false,
+		},
+	}
+}
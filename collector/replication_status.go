@@ -3,9 +3,9 @@ package collector
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"strconv"
 
-	"singlestore_exporter/log"
 	"singlestore_exporter/util"
 
 	"github.com/jmoiron/sqlx"
@@ -47,19 +47,22 @@ var (
 
 type ScrapeReplicationStatus struct{}
 
+func (s *ScrapeReplicationStatus) Name() string {
+	return "replication_status"
+}
+
 func (s *ScrapeReplicationStatus) Help() string {
 	return "Collect metrics from information_schema.MV_REPLICATION_STATUS"
 }
 
-func (s *ScrapeReplicationStatus) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) {
+func (s *ScrapeReplicationStatus) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
 	if db == nil {
-		return
+		return errNoConnection
 	}
 
 	rows := make([]ReplicationStatus, 0)
 	if err := db.SelectContext(ctx, &rows, infoSchemaReplicationStatusQuery); err != nil {
-		log.ErrorLogger.Errorf("scraping query failed: query=%s error=%v", infoSchemaReplicationStatusQuery, err)
-		return
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaReplicationStatusQuery, err)
 	}
 
 	for _, row := range rows {
@@ -82,4 +85,6 @@ func (s *ScrapeReplicationStatus) Scrape(ctx context.Context, db *sqlx.DB, ch ch
 			)
 		}
 	}
+
+	return nil
 }
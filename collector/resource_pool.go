@@ -0,0 +1,217 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ResourcePool is a row of information_schema.RESOURCE_POOLS, NULL when the pool has no such limit
+type ResourcePool struct {
+	PoolName               string        `db:"POOL_NAME"`
+	MemoryPercentage       sql.NullInt64 `db:"MEMORY_PERCENTAGE"`
+	QueryTimeout           sql.NullInt64 `db:"QUERY_TIMEOUT"`
+	SoftCPULimitPercentage sql.NullInt64 `db:"SOFT_CPU_LIMIT_PERCENTAGE"`
+	HardCPULimitPercentage sql.NullInt64 `db:"HARD_CPU_LIMIT_PERCENTAGE"`
+	MaxConcurrency         sql.NullInt64 `db:"MAX_CONCURRENCY"`
+}
+
+type ResourcePoolStatus struct {
+	NodeID         int64  `db:"NODE_ID"`
+	PoolName       string `db:"POOL_NAME"`
+	RunningQueries int64  `db:"RUNNING_QUERIES"`
+	QueuedQueries  int64  `db:"QUEUED_QUERIES"`
+}
+
+type WorkloadManagementStatus struct {
+	NodeID int64  `db:"NODE_ID"`
+	Stat   string `db:"STAT"`
+	Value  string `db:"VALUE"`
+}
+
+// QueuedProcesses are the processes of PROCESSLIST waiting in the queue of a pool for the same reason
+type QueuedProcesses struct {
+	ResourcePool      string `db:"RESOURCE_POOL"`
+	ReasonForQueueing string `db:"REASON_FOR_QUEUEING"`
+	Count             int64  `db:"PROCESS_COUNT"`
+	MaxTime           int64  `db:"MAX_TIME"`
+}
+
+const (
+	resourcePool = "resource_pool"
+
+	infoSchemaResourcePoolsQuery = `SELECT POOL_NAME, MEMORY_PERCENTAGE, QUERY_TIMEOUT, SOFT_CPU_LIMIT_PERCENTAGE, HARD_CPU_LIMIT_PERCENTAGE, MAX_CONCURRENCY
+FROM information_schema.RESOURCE_POOLS`
+
+	infoSchemaResourcePoolStatusQuery = `SELECT NODE_ID, POOL_NAME, NVL(RUNNING_QUERIES, 0) AS RUNNING_QUERIES, NVL(QUEUED_QUERIES, 0) AS QUEUED_QUERIES
+FROM information_schema.MV_RESOURCE_POOL_STATUS`
+
+	infoSchemaWorkloadManagementStatusQuery = `SELECT NODE_ID, STAT, NVL(VALUE, '') AS VALUE
+FROM information_schema.MV_WORKLOAD_MANAGEMENT_STATUS`
+
+	infoSchemaQueuedProcessesQuery = `SELECT NVL(RESOURCE_POOL, '') AS RESOURCE_POOL, REASON_FOR_QUEUEING, COUNT(*) AS PROCESS_COUNT, MAX(TIME) AS MAX_TIME
+FROM information_schema.PROCESSLIST
+WHERE REASON_FOR_QUEUEING IS NOT NULL AND REASON_FOR_QUEUEING != ''
+GROUP BY 1, 2`
+)
+
+var (
+	resourcePoolMemoryLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "memory_limit_ratio"),
+		"Share of the memory of a leaf which the queries of the pool may use, MEMORY_PERCENTAGE",
+		[]string{"pool"},
+		nil,
+	)
+
+	resourcePoolQueryTimeoutDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "query_timeout_seconds"),
+		"Time after which the queries of the pool are killed, QUERY_TIMEOUT",
+		[]string{"pool"},
+		nil,
+	)
+
+	resourcePoolSoftCPULimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "soft_cpu_limit_ratio"),
+		"Share of the CPU which the pool may use when others need it, SOFT_CPU_LIMIT_PERCENTAGE",
+		[]string{"pool"},
+		nil,
+	)
+
+	resourcePoolHardCPULimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "hard_cpu_limit_ratio"),
+		"Share of the CPU which the pool may use at most, HARD_CPU_LIMIT_PERCENTAGE",
+		[]string{"pool"},
+		nil,
+	)
+
+	resourcePoolMaxConcurrencyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "max_concurrency"),
+		"Queries of the pool which may run at once on an aggregator, MAX_CONCURRENCY",
+		[]string{"pool"},
+		nil,
+	)
+
+	resourcePoolRunningQueriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "running_queries"),
+		"Queries of the pool running on the node",
+		[]string{"node_id", "pool"},
+		nil,
+	)
+
+	resourcePoolQueuedQueriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "queued_queries"),
+		"Queries of the pool queued on the node",
+		[]string{"node_id", "pool"},
+		nil,
+	)
+
+	resourcePoolQueuedProcessesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "queued_processes"),
+		"Processes of the aggregator waiting in the queue of the pool, by REASON_FOR_QUEUEING",
+		[]string{"pool", "reason"},
+		nil,
+	)
+
+	resourcePoolQueueWaitMaxDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, resourcePool, "queue_wait_seconds_max"),
+		"Longest time a process of the aggregator has been waiting in the queue of the pool",
+		[]string{"pool"},
+		nil,
+	)
+
+	workloadManagementStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "workload_management", "status"),
+		"Statistic of workload management, e.g. queued queries and average queue time, from MV_WORKLOAD_MANAGEMENT_STATUS",
+		[]string{"node_id", "stat"},
+		nil,
+	)
+)
+
+// ScrapeResourcePool exports the limits of the resource pools, their running and queued queries,
+// the statistics of workload management, and why the processes of the aggregator are queued.
+type ScrapeResourcePool struct{}
+
+func (s *ScrapeResourcePool) Name() string {
+	return "resource_pool"
+}
+
+func (s *ScrapeResourcePool) Help() string {
+	return "Collect resource pools and workload management from information_schema"
+}
+
+func (s *ScrapeResourcePool) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if db == nil {
+		return errNoConnection
+	}
+
+	pools := make([]ResourcePool, 0)
+	if err := db.SelectContext(ctx, &pools, infoSchemaResourcePoolsQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaResourcePoolsQuery, err)
+	}
+
+	statuses := make([]ResourcePoolStatus, 0)
+	if err := db.SelectContext(ctx, &statuses, infoSchemaResourcePoolStatusQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaResourcePoolStatusQuery, err)
+	}
+
+	workload := make([]WorkloadManagementStatus, 0)
+	if err := db.SelectContext(ctx, &workload, infoSchemaWorkloadManagementStatusQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaWorkloadManagementStatusQuery, err)
+	}
+
+	queued := make([]QueuedProcesses, 0)
+	if err := db.SelectContext(ctx, &queued, infoSchemaQueuedProcessesQuery); err != nil {
+		return fmt.Errorf("scraping query failed: query=%s error=%v", infoSchemaQueuedProcessesQuery, err)
+	}
+
+	exportResourcePools(pools, statuses, ch)
+	exportWorkloadManagement(workload, queued, ch)
+	return nil
+}
+
+func exportResourcePools(pools []ResourcePool, statuses []ResourcePoolStatus, ch chan<- prometheus.Metric) {
+	// a NULL limit is not exported, the pool has no such limit
+	limit := func(desc *prometheus.Desc, value sql.NullInt64, scale float64, pool string) {
+		if value.Valid {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(value.Int64)*scale, pool)
+		}
+	}
+	for _, pool := range pools {
+		limit(resourcePoolMemoryLimitDesc, pool.MemoryPercentage, 0.01, pool.PoolName)
+		limit(resourcePoolQueryTimeoutDesc, pool.QueryTimeout, 1, pool.PoolName)
+		limit(resourcePoolSoftCPULimitDesc, pool.SoftCPULimitPercentage, 0.01, pool.PoolName)
+		limit(resourcePoolHardCPULimitDesc, pool.HardCPULimitPercentage, 0.01, pool.PoolName)
+		limit(resourcePoolMaxConcurrencyDesc, pool.MaxConcurrency, 1, pool.PoolName)
+	}
+
+	for _, status := range statuses {
+		nodeID := strconv.FormatInt(status.NodeID, 10)
+		ch <- prometheus.MustNewConstMetric(resourcePoolRunningQueriesDesc, prometheus.GaugeValue, float64(status.RunningQueries), nodeID, status.PoolName)
+		ch <- prometheus.MustNewConstMetric(resourcePoolQueuedQueriesDesc, prometheus.GaugeValue, float64(status.QueuedQueries), nodeID, status.PoolName)
+	}
+}
+
+func exportWorkloadManagement(workload []WorkloadManagementStatus, queued []QueuedProcesses, ch chan<- prometheus.Metric) {
+	for _, row := range workload {
+		value, ok := parseStatusValue(row.Value)
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(workloadManagementStatusDesc, prometheus.GaugeValue, value, strconv.FormatInt(row.NodeID, 10), row.Stat)
+	}
+
+	maxWait := make(map[string]int64)
+	for _, row := range queued {
+		ch <- prometheus.MustNewConstMetric(resourcePoolQueuedProcessesDesc, prometheus.GaugeValue, float64(row.Count), row.ResourcePool, row.ReasonForQueueing)
+		if wait, exists := maxWait[row.ResourcePool]; !exists || row.MaxTime > wait {
+			maxWait[row.ResourcePool] = row.MaxTime
+		}
+	}
+	for pool, wait := range maxWait {
+		ch <- prometheus.MustNewConstMetric(resourcePoolQueueWaitMaxDesc, prometheus.GaugeValue, float64(wait), pool)
+	}
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportResourcePool(t *testing.T) {
+	number := func(value int64) sql.NullInt64 {
+		return sql.NullInt64{Int64: value, Valid: true}
+	}
+	pools := []ResourcePool{
+		{PoolName: "batch", MemoryPercentage: number(40), QueryTimeout: number(600), HardCPULimitPercentage: number(25), MaxConcurrency: number(4)},
+	}
+	statuses := []ResourcePoolStatus{
+		{NodeID: 1, PoolName: "batch", RunningQueries: 4, QueuedQueries: 7},
+	}
+	workload := []WorkloadManagementStatus{
+		{NodeID: 1, Stat: "Queued Queries (from global queue)", Value: "7"},
+		{NodeID: 1, Stat: "Avg Queued Time (ms)", Value: "1520"},
+		{NodeID: 1, Stat: "Unknown", Value: "n/a"},
+	}
+	queued := []QueuedProcesses{
+		{ResourcePool: "batch", ReasonForQueueing: "Max Concurrency Exceeded", Count: 5, MaxTime: 30},
+		{ResourcePool: "batch", ReasonForQueueing: "Memory Limit Exceeded", Count: 2, MaxTime: 90},
+	}
+
+	ch := make(chan prometheus.Metric, 20)
+	exportResourcePools(pools, statuses, ch)
+	exportWorkloadManagement(workload, queued, ch)
+
+	got := metricValues(t, drain(ch))
+
+	assert.Equal(t, map[string]float64{
+		// pools without a soft CPU limit have none exported
+		resourcePoolMemoryLimitDesc.String() + ",pool=batch":                                         0.4,
+		resourcePoolQueryTimeoutDesc.String() + ",pool=batch":                                        600,
+		resourcePoolHardCPULimitDesc.String() + ",pool=batch":                                        0.25,
+		resourcePoolMaxConcurrencyDesc.String() + ",pool=batch":                                      4,
+		resourcePoolRunningQueriesDesc.String() + ",node_id=1,pool=batch":                            4,
+		resourcePoolQueuedQueriesDesc.String() + ",node_id=1,pool=batch":                             7,
+		workloadManagementStatusDesc.String() + ",node_id=1,stat=Queued Queries (from global queue)": 7,
+		workloadManagementStatusDesc.String() + ",node_id=1,stat=Avg Queued Time (ms)":               1520,
+		resourcePoolQueuedProcessesDesc.String() + ",pool=batch,reason=Max Concurrency Exceeded":     5,
+		resourcePoolQueuedProcessesDesc.String() + ",pool=batch,reason=Memory Limit Exceeded":        2,
+		resourcePoolQueueWaitMaxDesc.String() + ",pool=batch":                                        90,
+	}, got)
+}
@@ -7,5 +7,12 @@ import (
 )
 
 type Scraper interface {
-	Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric)
+	// Name of the scraper, used as the collector label of the scrape metrics and in the --collect.<name> flag.
+	Name() string
+
+	// Help describes what the scraper collects.
+	Help() string
+
+	// Scrape collects metrics into ch. A non-nil error marks the scrape as failed.
+	Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error
 }
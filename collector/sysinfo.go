@@ -0,0 +1,230 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"singlestore_exporter/log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SysinfoRow is a row of the MV_SYSINFO_* views, which hold the host stats in the JSON column
+type SysinfoRow struct {
+	IPAddr string `db:"IP_ADDR"`
+	Port   int64  `db:"PORT"`
+	Type   string `db:"TYPE"`
+	JSON   string `db:"JSON"`
+}
+
+const (
+	sysinfo = "sysinfo"
+)
+
+var (
+	sysinfoLabels = []string{"ip_addr", "port", "type"}
+
+	sysinfoCPUSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "cpu_seconds_total"),
+		"CPU time of the host by mode, from MV_SYSINFO_CPU",
+		append(sysinfoLabels, "mode"),
+		nil,
+	)
+
+	sysinfoCPUCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "cpus"),
+		"CPUs of the host, from MV_SYSINFO_CPU",
+		sysinfoLabels,
+		nil,
+	)
+
+	sysinfoMemoryTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "memory_total_bytes"),
+		"Memory of the host or of the cgroup of the node, from MV_SYSINFO_MEM",
+		append(sysinfoLabels, "scope"),
+		nil,
+	)
+
+	sysinfoMemoryUsedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "memory_used_bytes"),
+		"Memory used on the host or in the cgroup of the node, from MV_SYSINFO_MEM",
+		append(sysinfoLabels, "scope"),
+		nil,
+	)
+
+	sysinfoDiskReadBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "disk_read_bytes_total"),
+		"Bytes read from the disk, from MV_SYSINFO_DISK",
+		append(sysinfoLabels, "mount_point"),
+		nil,
+	)
+
+	sysinfoDiskWrittenBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "disk_written_bytes_total"),
+		"Bytes written to the disk, from MV_SYSINFO_DISK",
+		append(sysinfoLabels, "mount_point"),
+		nil,
+	)
+
+	sysinfoDiskReadsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "disk_reads_completed_total"),
+		"Reads completed by the disk, from MV_SYSINFO_DISK",
+		append(sysinfoLabels, "mount_point"),
+		nil,
+	)
+
+	sysinfoDiskWritesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "disk_writes_completed_total"),
+		"Writes completed by the disk, from MV_SYSINFO_DISK",
+		append(sysinfoLabels, "mount_point"),
+		nil,
+	)
+
+	sysinfoNetworkReceiveBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "network_receive_bytes_total"),
+		"Bytes received by the network interface, from MV_SYSINFO_NET",
+		append(sysinfoLabels, "interface"),
+		nil,
+	)
+
+	sysinfoNetworkTransmitBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sysinfo, "network_transmit_bytes_total"),
+		"Bytes transmitted by the network interface, from MV_SYSINFO_NET",
+		append(sysinfoLabels, "interface"),
+		nil,
+	)
+
+	sysinfoViews = []sysinfoView{
+		{
+			table: "MV_SYSINFO_CPU",
+			fields: []sysinfoField{
+				{name: "num_cpus", desc: sysinfoCPUCountDesc, valueType: prometheus.GaugeValue, scale: 1},
+				{name: "user_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "user"},
+				{name: "nice_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "nice"},
+				{name: "system_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "system"},
+				{name: "idle_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "idle"},
+				{name: "iowait_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "iowait"},
+				{name: "irq_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "irq"},
+				{name: "softirq_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "softirq"},
+				{name: "steal_ms", desc: sysinfoCPUSecondsDesc, valueType: prometheus.CounterValue, scale: 0.001, label: "steal"},
+			},
+		},
+		{
+			table: "MV_SYSINFO_MEM",
+			fields: []sysinfoField{
+				{name: "host_total_b", desc: sysinfoMemoryTotalDesc, valueType: prometheus.GaugeValue, scale: 1, label: "host"},
+				{name: "host_used_b", desc: sysinfoMemoryUsedDesc, valueType: prometheus.GaugeValue, scale: 1, label: "host"},
+				{name: "cgroup_total_b", desc: sysinfoMemoryTotalDesc, valueType: prometheus.GaugeValue, scale: 1, label: "cgroup"},
+				{name: "cgroup_used_b", desc: sysinfoMemoryUsedDesc, valueType: prometheus.GaugeValue, scale: 1, label: "cgroup"},
+			},
+		},
+		{
+			table:      "MV_SYSINFO_DISK",
+			labelField: "mount_point",
+			fields: []sysinfoField{
+				{name: "read_bytes", desc: sysinfoDiskReadBytesDesc, valueType: prometheus.CounterValue, scale: 1},
+				{name: "write_bytes", desc: sysinfoDiskWrittenBytesDesc, valueType: prometheus.CounterValue, scale: 1},
+				{name: "read_operations", desc: sysinfoDiskReadsDesc, valueType: prometheus.CounterValue, scale: 1},
+				{name: "write_operations", desc: sysinfoDiskWritesDesc, valueType: prometheus.CounterValue, scale: 1},
+			},
+		},
+		{
+			table:      "MV_SYSINFO_NET",
+			labelField: "interface",
+			fields: []sysinfoField{
+				{name: "received_bytes", desc: sysinfoNetworkReceiveBytesDesc, valueType: prometheus.CounterValue, scale: 1},
+				{name: "transmitted_bytes", desc: sysinfoNetworkTransmitBytesDesc, valueType: prometheus.CounterValue, scale: 1},
+			},
+		},
+	}
+)
+
+// sysinfoView is an information_schema view holding host stats of every node in its JSON column
+type sysinfoView struct {
+	table string
+	// labelField is the JSON field telling the rows of a node apart, e.g. the mount point of MV_SYSINFO_DISK
+	labelField string
+	fields     []sysinfoField
+}
+
+// sysinfoField is a number of the JSON column exported as a metric
+type sysinfoField struct {
+	name      string
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	// scale converts the field to the unit of the metric, e.g. milliseconds to seconds
+	scale float64
+	// label is the value of the last label of desc when the fields share it, e.g. the mode of CPU time
+	label string
+}
+
+func (v sysinfoView) query() string {
+	return "SELECT IP_ADDR, PORT, NVL(TYPE, '') AS TYPE, JSON FROM information_schema." + v.table
+}
+
+// ScrapeSysinfo exports the host stats which every node reports in the MV_SYSINFO_* views,
+// to watch the hosts of the whole cluster from the aggregator where node_exporter cannot be installed.
+type ScrapeSysinfo struct{}
+
+func (s *ScrapeSysinfo) Name() string {
+	return "sysinfo"
+}
+
+func (s *ScrapeSysinfo) Help() string {
+	return "Collect CPU, memory, disk and network of the hosts from information_schema.MV_SYSINFO_*"
+}
+
+func (s *ScrapeSysinfo) Scrape(ctx context.Context, db *sqlx.DB, ch chan<- prometheus.Metric) error {
+	if db == nil {
+		return errNoConnection
+	}
+
+	// a view may be missing on older versions, which does not hide the others
+	failed := 0
+	for _, view := range sysinfoViews {
+		rows := make([]SysinfoRow, 0)
+		if err := db.SelectContext(ctx, &rows, view.query()); err != nil {
+			log.ErrorLogger.Errorf("scraping query failed: query=%s error=%v", view.query(), err)
+			failed++
+			continue
+		}
+		view.export(rows, ch)
+	}
+
+	if failed == len(sysinfoViews) {
+		return fmt.Errorf("scraping every sysinfo view failed: views=%d", failed)
+	}
+	return nil
+}
+
+func (v sysinfoView) export(rows []SysinfoRow, ch chan<- prometheus.Metric) {
+	for _, row := range rows {
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(row.JSON), &fields); err != nil {
+			log.ErrorLogger.Errorf("invalid sysinfo json: table=%s ip_addr=%s port=%d error=%v", v.table, row.IPAddr, row.Port, err)
+			continue
+		}
+
+		labelValues := []string{row.IPAddr, strconv.FormatInt(row.Port, 10), row.Type}
+		if v.labelField != "" {
+			value, _ := fields[v.labelField].(string)
+			labelValues = append(labelValues, value)
+		}
+
+		for _, field := range v.fields {
+			// fields missing on the version of the node are skipped
+			value, ok := fields[field.name].(float64)
+			if !ok {
+				continue
+			}
+			values := labelValues
+			if field.label != "" {
+				values = append(values[:len(values):len(values)], field.label)
+			}
+			ch <- prometheus.MustNewConstMetric(field.desc, field.valueType, value*field.scale, values...)
+		}
+	}
+}
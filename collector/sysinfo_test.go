@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSysinfoViewExport(t *testing.T) {
+	tt := []struct {
+		name     string
+		view     sysinfoView
+		rows     []SysinfoRow
+		expected map[string]float64
+	}{
+		{
+			name: "cpu",
+			view: sysinfoViews[0],
+			rows: []SysinfoRow{
+				{IPAddr: "10.0.0.3", Port: 3307, Type: "host", JSON: `{"num_cpus":16,"user_ms":1520340,"nice_ms":20,"system_ms":402110,"idle_ms":98120450,"iowait_ms":5310,"irq_ms":0,"softirq_ms":12040,"steal_ms":0}`},
+			},
+			expected: map[string]float64{
+				sysinfoCPUCountDesc.String() + ",ip_addr=10.0.0.3,port=3307,type=host":                16,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=user,port=3307,type=host":    1520.34,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=nice,port=3307,type=host":    0.02,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=system,port=3307,type=host":  402.11,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=idle,port=3307,type=host":    98120.45,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=iowait,port=3307,type=host":  5.31,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=irq,port=3307,type=host":     0,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=softirq,port=3307,type=host": 12.04,
+				sysinfoCPUSecondsDesc.String() + ",ip_addr=10.0.0.3,mode=steal,port=3307,type=host":   0,
+			},
+		},
+		{
+			name: "memory without cgroup",
+			view: sysinfoViews[1],
+			rows: []SysinfoRow{
+				{IPAddr: "10.0.0.3", Port: 3307, Type: "host", JSON: `{"host_total_b":67430506496,"host_used_b":41231687680}`},
+			},
+			expected: map[string]float64{
+				sysinfoMemoryTotalDesc.String() + ",ip_addr=10.0.0.3,port=3307,scope=host,type=host": 67430506496,
+				sysinfoMemoryUsedDesc.String() + ",ip_addr=10.0.0.3,port=3307,scope=host,type=host":  41231687680,
+			},
+		},
+		{
+			name: "disk by mount point",
+			view: sysinfoViews[2],
+			rows: []SysinfoRow{
+				{IPAddr: "10.0.0.3", Port: 3307, Type: "host", JSON: `{"mount_point":"/data","read_bytes":1048576,"write_bytes":4194304,"read_operations":256,"write_operations":1024}`},
+				{IPAddr: "10.0.0.3", Port: 3307, Type: "host", JSON: `{"mount_point":"/","read_bytes":2048,"write_bytes":0}`},
+			},
+			expected: map[string]float64{
+				sysinfoDiskReadBytesDesc.String() + ",ip_addr=10.0.0.3,mount_point=/data,port=3307,type=host":    1048576,
+				sysinfoDiskWrittenBytesDesc.String() + ",ip_addr=10.0.0.3,mount_point=/data,port=3307,type=host": 4194304,
+				sysinfoDiskReadsDesc.String() + ",ip_addr=10.0.0.3,mount_point=/data,port=3307,type=host":        256,
+				sysinfoDiskWritesDesc.String() + ",ip_addr=10.0.0.3,mount_point=/data,port=3307,type=host":       1024,
+				sysinfoDiskReadBytesDesc.String() + ",ip_addr=10.0.0.3,mount_point=/,port=3307,type=host":        2048,
+				sysinfoDiskWrittenBytesDesc.String() + ",ip_addr=10.0.0.3,mount_point=/,port=3307,type=host":     0,
+			},
+		},
+		{
+			name: "network by interface, invalid json is skipped",
+			view: sysinfoViews[3],
+			rows: []SysinfoRow{
+				{IPAddr: "10.0.0.3", Port: 3307, Type: "host", JSON: `{"interface":"eth0","received_bytes":9876543210,"transmitted_bytes":1234567890}`},
+				{IPAddr: "10.0.0.4", Port: 3307, Type: "host", JSON: `not json`},
+			},
+			expected: map[string]float64{
+				sysinfoNetworkReceiveBytesDesc.String() + ",interface=eth0,ip_addr=10.0.0.3,port=3307,type=host":  9876543210,
+				sysinfoNetworkTransmitBytesDesc.String() + ",interface=eth0,ip_addr=10.0.0.3,port=3307,type=host": 1234567890,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := make(chan prometheus.Metric, 20)
+			tc.view.export(tc.rows, ch)
+			got := metricValues(t, drain(ch))
+			assert.Equal(t, len(tc.expected), len(got))
+			for key, value := range tc.expected {
+				assert.InDelta(t, value, got[key], 1e-9, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// targetStateTTL is how long the state of a target is kept after its last scrape
+const targetStateTTL = time.Hour
+
+type targetKeyContextKey struct{}
+
+// withTargetKey tells stateful scrapers which target they scrape, e.g. the redacted DSN of a /probe target
+func withTargetKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, targetKeyContextKey{}, key)
+}
+
+func targetKey(ctx context.Context) string {
+	key, _ := ctx.Value(targetKeyContextKey{}).(string)
+	return key
+}
+
+// ScraperStates holds the state of the stateful scrapers. It is owned by the caller of Registry,
+// so that counters survive reloads, which re-create the scrapers and may re-create the connection pools.
+type ScraperStates struct {
+	activities *targetStates[activityState]
+	planCache  *targetStates[planCacheState]
+	// dataDiskUsage is node-local, there is only the host the exporter runs on
+	dataDiskUsage *dataDiskUsageCache
+}
+
+func NewScraperStates() *ScraperStates {
+	return &ScraperStates{
+		activities: newTargetStates(newActivityState),
+		planCache:  newTargetStates(newPlanCacheState),
+
+		dataDiskUsage: newDataDiskUsageCache(),
+	}
+}
+
+// targetStates keeps the state of a scraper per target, and expires the state of targets which are not scraped any more.
+type targetStates[T any] struct {
+	newState func() *T
+
+	mu     sync.Mutex
+	states map[string]*targetState[T]
+}
+
+type targetState[T any] struct {
+	state    *T
+	lastUsed time.Time
+}
+
+func newTargetStates[T any](newState func() *T) *targetStates[T] {
+	return &targetStates[T]{
+		newState: newState,
+		states:   make(map[string]*targetState[T]),
+	}
+}
+
+// update calls f with the state of the target of ctx, serialized with every other update.
+func (p *targetStates[T]) update(ctx context.Context, f func(state *T) []prometheus.Metric) []prometheus.Metric {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for key, state := range p.states {
+		if now.Sub(state.lastUsed) > targetStateTTL {
+			delete(p.states, key)
+		}
+	}
+
+	key := targetKey(ctx)
+	state, exists := p.states[key]
+	if !exists {
+		state = &targetState[T]{state: p.newState()}
+		p.states[key] = state
+	}
+	state.lastUsed = now
+	return f(state.state)
+}
@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetStates(t *testing.T) {
+	type counter struct{ scrapes int }
+	states := newTargetStates(func() *counter { return &counter{} })
+	scrapes := func(ctx context.Context) int {
+		var got int
+		states.update(ctx, func(state *counter) []prometheus.Metric {
+			state.scrapes++
+			got = state.scrapes
+			return nil
+		})
+		return got
+	}
+
+	a := withTargetKey(context.Background(), "root@tcp(10.0.0.1:3306)/")
+	b := withTargetKey(context.Background(), "root@tcp(10.0.0.2:3306)/")
+
+	assert.Equal(t, 1, scrapes(a))
+	// a new context of the same target, e.g. after a reload, shares its state
+	assert.Equal(t, 2, scrapes(withTargetKey(context.Background(), "root@tcp(10.0.0.1:3306)/")))
+	assert.Equal(t, 1, scrapes(b))
+}
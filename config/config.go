@@ -0,0 +1,370 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the exporter.
+// Defaults come from command line flags, and the config file overrides the keys it sets.
+type Config struct {
+	Web             WebConfig             `yaml:"web"`
+	Scrape          ScrapeConfig          `yaml:"scrape"`
+	Log             LogConfig             `yaml:"log"`
+	DSN             DSNConfig             `yaml:"dsn"`
+	DB              DBConfig              `yaml:"db"`
+	Collectors      Collectors            `yaml:"collectors"`
+	SlowQuery       SlowQueryConfig       `yaml:"slow_query"`
+	Nodes           NodesConfig           `yaml:"nodes"`
+	DataDiskUsage   DataDiskUsageConfig   `yaml:"data_disk_usage"`
+	Memsqlctl       MemsqlctlConfig       `yaml:"memsqlctl"`
+	Activities      ActivitiesConfig      `yaml:"activities"`
+	PlanCache       PlanCacheConfig       `yaml:"plancache"`
+	GlobalStatus    GlobalStatusConfig    `yaml:"global_status"`
+	GlobalVariables GlobalVariablesConfig `yaml:"global_variables"`
+	Memory          MemoryConfig          `yaml:"memory"`
+	Debug           DebugConfig           `yaml:"debug"`
+	Probe           ProbeConfig           `yaml:"probe"`
+
+	// AuthModules are credentials used by /probe, selected with the auth_module URL parameter.
+	AuthModules map[string]AuthModule `yaml:"auth_modules"`
+}
+
+type WebConfig struct {
+	// ListenAddress is only read at startup
+	ListenAddress string `yaml:"listen_address"`
+	// ShutdownTimeout is how long in-flight scrapes may take to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type ScrapeConfig struct {
+	// TimeoutOffset is subtracted from X-Prometheus-Scrape-Timeout-Seconds,
+	// leaving time to send the partial results before Prometheus gives up.
+	TimeoutOffset time.Duration `yaml:"timeout_offset"`
+	// MinInterval serves the last result of the same collectors until it is older than this.
+	// Concurrent scrapes are always shared, zero only turns the cache off.
+	MinInterval time.Duration `yaml:"min_interval"`
+}
+
+type LogConfig struct {
+	Path  string `yaml:"path"`
+	Level string `yaml:"level"`
+}
+
+// DSNConfig holds the sources of the connection settings of the aggregator, see MySQLConfig.
+type DSNConfig struct {
+	// DataSourceName is used as is when set
+	DataSourceName string `yaml:"data_source_name"`
+	// Env is the environment variable holding the DSN, used when DataSourceName is empty
+	Env string `yaml:"env"`
+	// CredentialsFile is a my.cnf-style file, used when neither DataSourceName nor Env is set
+	CredentialsFile string `yaml:"credentials_file"`
+	// PasswordFile holds the password alone. It is re-read on every new connection, so it can be rotated.
+	PasswordFile string `yaml:"password_file"`
+}
+
+type DBConfig struct {
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// TLS applies to the aggregator and to every /probe target
+	TLS DBTLSConfig `yaml:"tls"`
+}
+
+type DBTLSConfig struct {
+	// CAFile verifies the server certificate instead of the system roots
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName is verified instead of the host of the DSN
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// Enabled tells whether any TLS setting is set, turning TLS on.
+func (c *DBTLSConfig) Enabled() bool {
+	return *c != DBTLSConfig{}
+}
+
+// Collectors maps collector names to their settings.
+type Collectors map[string]CollectorConfig
+
+// UnmarshalYAML merges each collector of the file into the existing entry,
+// so that e.g. setting only the timeout of a collector keeps it enabled.
+func (c *Collectors) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: collectors must be a mapping", value.Line)
+	}
+	if *c == nil {
+		*c = make(Collectors)
+	}
+
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		name := value.Content[i].Value
+
+		// decode through a strict decoder, Node.Decode ignores unknown fields
+		b, err := yaml.Marshal(value.Content[i+1])
+		if err != nil {
+			return err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(b))
+		decoder.KnownFields(true)
+
+		collector := (*c)[name]
+		if err := decoder.Decode(&collector); err != nil && err != io.EOF {
+			return fmt.Errorf("line %d: collectors.%s: %v", value.Content[i].Line, name, err)
+		}
+		(*c)[name] = collector
+	}
+	return nil
+}
+
+type CollectorConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Timeout limits a single scrape of the collector, zero means no limit besides the scrape timeout
+	Timeout time.Duration `yaml:"timeout"`
+	// BackgroundInterval runs the collector in the background on this interval, instead of on every scrape.
+	// Scrapes are served from the last successful run.
+	BackgroundInterval time.Duration `yaml:"background_interval"`
+}
+
+// SlowQueryConfig sets the slow_query collector. Processes matching any exception are not counted.
+type SlowQueryConfig struct {
+	Threshold int    `yaml:"threshold"`
+	LogPath   string `yaml:"log_path"`
+	// ExceptionHosts are SQL LIKE patterns of client hosts, without the port
+	ExceptionHosts []string `yaml:"exception_hosts"`
+	// ExceptionInfoPatterns are SQL LIKE patterns contained in the query text, ignoring case
+	ExceptionInfoPatterns []string `yaml:"exception_info_patterns"`
+	// ExceptionInfoRegexps are regular expressions matched against the query text
+	ExceptionInfoRegexps   []string `yaml:"exception_info_regexps"`
+	ExceptionUsers         []string `yaml:"exception_users"`
+	ExceptionDBs           []string `yaml:"exception_dbs"`
+	ExceptionCommands      []string `yaml:"exception_commands"`
+	ExceptionResourcePools []string `yaml:"exception_resource_pools"`
+
+	// infoRegexps are ExceptionInfoRegexps compiled by Validate
+	infoRegexps []*regexp.Regexp
+}
+
+// InfoRegexps returns ExceptionInfoRegexps as compiled by Validate.
+func (c *SlowQueryConfig) InfoRegexps() []*regexp.Regexp {
+	return c.infoRegexps
+}
+
+type NodesConfig struct {
+	// Source is memsqlctl, sql, or auto which uses memsqlctl when it can be run and sql otherwise
+	Source string `yaml:"source"`
+}
+
+type DataDiskUsageConfig struct {
+	// Parallelism is the maximum number of nodes queried at once
+	Parallelism int `yaml:"parallelism"`
+	// CommandTimeout limits every memsqlctl command, along with memsqlctl.timeout: the shorter one wins
+	CommandTimeout time.Duration `yaml:"command_timeout"`
+	// Deprecated: ScrapeInterval is read into collectors.data_disk_usage.background_interval by LoadFile,
+	// so that config files written before background collectors keep working.
+	ScrapeInterval time.Duration `yaml:"scrape_interval"`
+}
+
+// MemsqlctlConfig sets how the node-local collectors run memsqlctl.
+type MemsqlctlConfig struct {
+	Path string `yaml:"path"`
+	// Prefix is prepended to every command, e.g. [sudo, -n, -u, memsql]
+	Prefix []string `yaml:"prefix"`
+	// Timeout limits every memsqlctl command
+	Timeout time.Duration `yaml:"timeout"`
+	// InventoryTTL is how long the output of list-nodes is shared by the collectors
+	InventoryTTL time.Duration `yaml:"inventory_ttl"`
+}
+
+type ActivitiesConfig struct {
+	// TopQueries is the number of queries exported with their own query label, the others are summed up as other
+	TopQueries int `yaml:"top_queries"`
+}
+
+type PlanCacheConfig struct {
+	// TopPlans is the number of plans exported with their own series, the others are summed up as other
+	TopPlans int `yaml:"top_plans"`
+	// Ranking selects the top plans: execution_time, executions, rows, average_execution_time or memory
+	Ranking string `yaml:"ranking"`
+}
+
+type GlobalStatusConfig struct {
+	// Allowlist holds regexps of the lower case names of status variables without a known type,
+	// which are exported as untyped. A regexp has to match the whole name.
+	Allowlist []string `yaml:"allowlist"`
+}
+
+type GlobalVariablesConfig struct {
+	// InfoAllowlist holds regexps of the lower case names of variables which are not numbers,
+	// which are exported as singlestore_variable_info. A regexp has to match the whole name.
+	InfoAllowlist []string `yaml:"info_allowlist"`
+}
+
+type MemoryConfig struct {
+	// Source is sql, memsqlctl, or auto which uses sql when a DSN is configured and memsqlctl otherwise
+	Source string `yaml:"source"`
+}
+
+type DebugConfig struct {
+	Pprof bool `yaml:"pprof"`
+}
+
+type ProbeConfig struct {
+	// MaxTargets is the number of connection pools kept open for /probe, one per target and auth module
+	MaxTargets int `yaml:"max_targets"`
+	// IdleTimeout closes the connection pool of a target which was not probed for this long
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+type AuthModule struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// LoadFile reads the YAML file at path on top of cfg, which holds the defaults.
+// An empty path leaves cfg untouched.
+func LoadFile(path string, cfg *Config) error {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: path=%s err=%v", path, err)
+		}
+
+		defaultInterval := cfg.Collectors["data_disk_usage"].BackgroundInterval
+		decoder := yaml.NewDecoder(bytes.NewReader(b))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+			return fmt.Errorf("failed to parse config file: path=%s err=%v", path, err)
+		}
+
+		if interval := cfg.DataDiskUsage.ScrapeInterval; interval != 0 {
+			collector := cfg.Collectors["data_disk_usage"]
+			if collector.BackgroundInterval != defaultInterval && collector.BackgroundInterval != interval {
+				return fmt.Errorf("data_disk_usage.scrape_interval is deprecated and conflicts with collectors.data_disk_usage.background_interval: path=%s", path)
+			}
+			collector.BackgroundInterval = interval
+			if cfg.Collectors == nil {
+				cfg.Collectors = make(Collectors)
+			}
+			cfg.Collectors["data_disk_usage"] = collector
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: path=%s err=%v", path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.Web.ListenAddress == "" {
+		return fmt.Errorf("web.listen_address is empty")
+	}
+	if c.Web.ShutdownTimeout < 0 {
+		return fmt.Errorf("web.shutdown_timeout is negative: %s", c.Web.ShutdownTimeout)
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("log.level must be debug, info, warn or error: %s", c.Log.Level)
+	}
+	if c.Scrape.TimeoutOffset < 0 {
+		return fmt.Errorf("scrape.timeout_offset is negative: %s", c.Scrape.TimeoutOffset)
+	}
+	if c.Scrape.MinInterval < 0 {
+		return fmt.Errorf("scrape.min_interval is negative: %s", c.Scrape.MinInterval)
+	}
+	for name, collector := range c.Collectors {
+		if collector.Timeout < 0 {
+			return fmt.Errorf("collectors.%s.timeout is negative: %s", name, collector.Timeout)
+		}
+		if collector.BackgroundInterval < 0 {
+			return fmt.Errorf("collectors.%s.background_interval is negative: %s", name, collector.BackgroundInterval)
+		}
+	}
+	if c.SlowQuery.Threshold < 0 {
+		return fmt.Errorf("slow_query.threshold is negative: %d", c.SlowQuery.Threshold)
+	}
+	c.SlowQuery.infoRegexps = nil
+	for _, expr := range c.SlowQuery.ExceptionInfoRegexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("slow_query.exception_info_regexps is invalid: %v", err)
+		}
+		c.SlowQuery.infoRegexps = append(c.SlowQuery.infoRegexps, re)
+	}
+	switch c.Nodes.Source {
+	case "memsqlctl", "sql", "auto":
+	default:
+		return fmt.Errorf("nodes.source must be memsqlctl, sql or auto: %s", c.Nodes.Source)
+	}
+	if c.DataDiskUsage.Parallelism < 1 {
+		return fmt.Errorf("data_disk_usage.parallelism must be positive: %d", c.DataDiskUsage.Parallelism)
+	}
+	if c.DataDiskUsage.ScrapeInterval < 0 {
+		return fmt.Errorf("data_disk_usage.scrape_interval is negative: %s", c.DataDiskUsage.ScrapeInterval)
+	}
+	if c.DataDiskUsage.CommandTimeout < 0 {
+		return fmt.Errorf("data_disk_usage.command_timeout is negative: %s", c.DataDiskUsage.CommandTimeout)
+	}
+	if c.Memsqlctl.Path == "" {
+		return fmt.Errorf("memsqlctl.path is empty")
+	}
+	if c.Memsqlctl.Timeout < 0 || c.Memsqlctl.InventoryTTL < 0 {
+		return fmt.Errorf("memsqlctl.timeout and memsqlctl.inventory_ttl must not be negative")
+	}
+	if c.Activities.TopQueries < 0 {
+		return fmt.Errorf("activities.top_queries is negative: %d", c.Activities.TopQueries)
+	}
+	if c.PlanCache.TopPlans < 0 {
+		return fmt.Errorf("plancache.top_plans is negative: %d", c.PlanCache.TopPlans)
+	}
+	switch c.PlanCache.Ranking {
+	case "execution_time", "executions", "rows", "average_execution_time", "memory":
+	default:
+		return fmt.Errorf("plancache.ranking must be execution_time, executions, rows, average_execution_time or memory: %s", c.PlanCache.Ranking)
+	}
+	for _, expr := range c.GlobalStatus.Allowlist {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("global_status.allowlist is invalid: %v", err)
+		}
+	}
+	for _, expr := range c.GlobalVariables.InfoAllowlist {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("global_variables.info_allowlist is invalid: %v", err)
+		}
+	}
+	switch c.Memory.Source {
+	case "memsqlctl", "sql", "auto":
+	default:
+		return fmt.Errorf("memory.source must be memsqlctl, sql or auto: %s", c.Memory.Source)
+	}
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 {
+		return fmt.Errorf("db.max_open_conns and db.max_idle_conns must not be negative")
+	}
+	if (c.DB.TLS.CertFile == "") != (c.DB.TLS.KeyFile == "") {
+		return fmt.Errorf("db.tls.cert_file and db.tls.key_file must be set together")
+	}
+	if c.Probe.MaxTargets < 1 {
+		return fmt.Errorf("probe.max_targets must be positive: %d", c.Probe.MaxTargets)
+	}
+	if c.Probe.IdleTimeout <= 0 {
+		return fmt.Errorf("probe.idle_timeout must be positive: %s", c.Probe.IdleTimeout)
+	}
+	for name, module := range c.AuthModules {
+		if module.User == "" {
+			return fmt.Errorf("auth module has no user: auth_module=%s", name)
+		}
+	}
+	return nil
+}
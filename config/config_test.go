@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func defaultConfig() *Config {
+	return &Config{
+		Web: WebConfig{ListenAddress: "0.0.0.0:9105"},
+		Log: LogConfig{Level: "info"},
+		Collectors: Collectors{
+			"nodes":      {Enabled: true},
+			"slow_query": {Enabled: false},
+		},
+		SlowQuery:     SlowQueryConfig{Threshold: 10},
+		Nodes:         NodesConfig{Source: "memsqlctl"},
+		DataDiskUsage: DataDiskUsageConfig{Parallelism: 4, CommandTimeout: 10 * time.Second},
+		Memsqlctl:     MemsqlctlConfig{Path: "/usr/bin/memsqlctl", Timeout: 30 * time.Second, InventoryTTL: 5 * time.Second},
+		Activities:    ActivitiesConfig{TopQueries: 20},
+		PlanCache:     PlanCacheConfig{TopPlans: 20, Ranking: "execution_time"},
+		Memory:        MemoryConfig{Source: "auto"},
+		Probe:         ProbeConfig{MaxTargets: 100, IdleTimeout: 10 * time.Minute},
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tt := []struct {
+		name        string
+		content     string
+		expectedErr bool
+		check       func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:    "empty file keeps defaults",
+			content: "",
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, defaultConfig(), cfg)
+			},
+		},
+		{
+			name: "file overrides only the keys it sets",
+			content: `
+collectors:
+  slow_query:
+    enabled: true
+  nodes:
+    background_interval: 1m
+slow_query:
+  threshold: 5
+  exception_hosts: [localhost]
+`,
+			check: func(t *testing.T, cfg *Config) {
+				assert.True(t, cfg.Collectors["nodes"].Enabled)
+				assert.Equal(t, time.Minute, cfg.Collectors["nodes"].BackgroundInterval)
+				assert.True(t, cfg.Collectors["slow_query"].Enabled)
+				assert.Equal(t, 5, cfg.SlowQuery.Threshold)
+				assert.Equal(t, []string{"localhost"}, cfg.SlowQuery.ExceptionHosts)
+				assert.Equal(t, "0.0.0.0:9105", cfg.Web.ListenAddress)
+			},
+		},
+		{
+			name:    "collector settings are merged into the defaults",
+			content: "collectors:\n  nodes:\n    timeout: 5s\n",
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, CollectorConfig{Enabled: true, Timeout: 5 * time.Second}, cfg.Collectors["nodes"])
+			},
+		},
+		{
+			name:        "unknown keys of a collector are rejected",
+			content:     "collectors:\n  nodes:\n    enable: true\n",
+			expectedErr: true,
+		},
+		{
+			name:    "deprecated data_disk_usage.scrape_interval sets the background interval",
+			content: "data_disk_usage:\n  scrape_interval: 1m\n",
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, time.Minute, cfg.Collectors["data_disk_usage"].BackgroundInterval)
+			},
+		},
+		{
+			name:        "deprecated data_disk_usage.scrape_interval conflicting with background_interval is rejected",
+			content:     "data_disk_usage:\n  scrape_interval: 1m\ncollectors:\n  data_disk_usage:\n    background_interval: 2m\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown keys are rejected",
+			content:     "slow_query:\n  treshold: 5\n",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid values are rejected",
+			content:     "collectors:\n  nodes:\n    background_interval: -1s\n",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid slow query regexps are rejected",
+			content:     "slow_query:\n  exception_info_regexps: ['(unclosed']\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown nodes source is rejected",
+			content:     "nodes:\n  source: ssh\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown plancache ranking is rejected",
+			content:     "plancache:\n  ranking: cpu\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown memory source is rejected",
+			content:     "memory:\n  source: ssh\n",
+			expectedErr: true,
+		},
+		{
+			name:        "db client certificate without key is rejected",
+			content:     "db:\n  tls:\n    cert_file: client.pem\n",
+			expectedErr: true,
+		},
+		{
+			name:        "auth module without user is rejected",
+			content:     "auth_modules:\n  prod:\n    password: secret\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			assert.NoError(t, os.WriteFile(path, []byte(tc.content), 0600))
+
+			cfg := defaultConfig()
+			err := LoadFile(path, cfg)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			tc.check(t, cfg)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/ini.v1"
+)
+
+// MySQLConfig resolves the connection settings of the aggregator from the first source which is set:
+// data_source_name, the environment variable env, then credentials_file.
+// password_file overrides the password of any of them, and is re-read on every new connection.
+// It returns nil on nodes which only run node-local collectors.
+func (c *DSNConfig) MySQLConfig() (*mysql.Config, error) {
+	var cfg *mysql.Config
+	var err error
+	switch {
+	case c.DataSourceName != "":
+		if cfg, err = mysql.ParseDSN(c.DataSourceName); err != nil {
+			return nil, fmt.Errorf("failed to parse dsn.data_source_name: err=%v", err)
+		}
+	case c.Env != "" && os.Getenv(c.Env) != "":
+		if cfg, err = mysql.ParseDSN(os.Getenv(c.Env)); err != nil {
+			return nil, fmt.Errorf("failed to parse the DSN of the environment variable: env=%s err=%v", c.Env, err)
+		}
+	case c.CredentialsFile != "":
+		if cfg, err = readCredentialsFile(c.CredentialsFile); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	if c.PasswordFile != "" {
+		// read it once to reject a broken path on load, the driver reads it again before connecting
+		if cfg.Passwd, err = readPasswordFile(c.PasswordFile); err != nil {
+			return nil, err
+		}
+		path := c.PasswordFile
+		err := cfg.Apply(mysql.BeforeConnect(func(ctx context.Context, cfg *mysql.Config) error {
+			password, err := readPasswordFile(path)
+			if err != nil {
+				return err
+			}
+			cfg.Passwd = password
+			return nil
+		}))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.DBName = "information_schema"
+	cfg.ParseTime = true
+	return cfg, nil
+}
+
+// readCredentialsFile reads the [client] section of a my.cnf-style file:
+//
+//	[client]
+//	user = exporter
+//	password = secret
+//	host = localhost
+//	port = 3306
+//
+// socket replaces host and port when set.
+func readCredentialsFile(path string) (*mysql.Config, error) {
+	file, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: path=%s err=%v", path, err)
+	}
+	section, err := file.GetSection("client")
+	if err != nil {
+		return nil, fmt.Errorf("credentials file has no [client] section: path=%s", path)
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = section.Key("user").String()
+	cfg.Passwd = section.Key("password").String()
+	if cfg.User == "" {
+		return nil, fmt.Errorf("credentials file has no user: path=%s", path)
+	}
+
+	if socket := section.Key("socket").String(); socket != "" {
+		cfg.Net = "unix"
+		cfg.Addr = socket
+	} else {
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(
+			section.Key("host").MustString("localhost"),
+			section.Key("port").MustString("3306"),
+		)
+	}
+	return cfg, nil
+}
+
+// readPasswordFile reads a file holding only the password, ignoring the trailing newline
+func readPasswordFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: path=%s err=%v", path, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
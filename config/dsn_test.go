@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	credentialsFile := write("my.cnf", "[client]\nuser = exporter\npassword = from-file\nhost = aggregator\nport = 3307\n")
+	socketFile := write("socket.cnf", "[client]\nuser = exporter\nsocket = /var/run/memsql.sock\n")
+	noUserFile := write("nouser.cnf", "[client]\npassword = secret\n")
+	passwordFile := write("password", "rotated\n")
+
+	t.Setenv("TEST_DATA_SOURCE_NAME", "exporter:from-env@tcp(aggregator:3306)/")
+
+	tt := []struct {
+		name         string
+		dsn          DSNConfig
+		expectedErr  bool
+		expectedNil  bool
+		expectedDSN  string
+		expectedPass string
+	}{
+		{
+			name:        "nothing set",
+			dsn:         DSNConfig{Env: "TEST_UNSET_DATA_SOURCE_NAME"},
+			expectedNil: true,
+		},
+		{
+			name:         "data source name",
+			dsn:          DSNConfig{DataSourceName: "exporter:secret@tcp(aggregator:3306)/"},
+			expectedDSN:  "exporter:secret@tcp(aggregator:3306)/information_schema?parseTime=true",
+			expectedPass: "secret",
+		},
+		{
+			name:         "environment variable",
+			dsn:          DSNConfig{Env: "TEST_DATA_SOURCE_NAME", CredentialsFile: credentialsFile},
+			expectedDSN:  "exporter:from-env@tcp(aggregator:3306)/information_schema?parseTime=true",
+			expectedPass: "from-env",
+		},
+		{
+			name:         "credentials file when the environment variable is empty",
+			dsn:          DSNConfig{Env: "TEST_UNSET_DATA_SOURCE_NAME", CredentialsFile: credentialsFile},
+			expectedDSN:  "exporter:from-file@tcp(aggregator:3307)/information_schema?parseTime=true",
+			expectedPass: "from-file",
+		},
+		{
+			name:        "credentials file with a socket",
+			dsn:         DSNConfig{CredentialsFile: socketFile},
+			expectedDSN: "exporter@unix(/var/run/memsql.sock)/information_schema?parseTime=true",
+		},
+		{
+			name:        "credentials file without user",
+			dsn:         DSNConfig{CredentialsFile: noUserFile},
+			expectedErr: true,
+		},
+		{
+			name:         "password file overrides the password",
+			dsn:          DSNConfig{CredentialsFile: credentialsFile, PasswordFile: passwordFile},
+			expectedDSN:  "exporter:rotated@tcp(aggregator:3307)/information_schema?parseTime=true",
+			expectedPass: "rotated",
+		},
+		{
+			name:        "missing password file",
+			dsn:         DSNConfig{CredentialsFile: credentialsFile, PasswordFile: filepath.Join(dir, "missing")},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid data source name",
+			dsn:         DSNConfig{DataSourceName: "exporter:secret@tcp(aggregator:3306"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := tc.dsn.MySQLConfig()
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.expectedNil {
+				assert.Nil(t, cfg)
+				return
+			}
+			assert.Equal(t, tc.expectedDSN, cfg.FormatDSN())
+			assert.Equal(t, tc.expectedPass, cfg.Passwd)
+		})
+	}
+}
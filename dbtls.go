@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+
+	"singlestore_exporter/config"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	dbTLSConfigNamePrefix = "singlestore_exporter_"
+)
+
+var (
+	dbTLSCertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "singlestore",
+		Subsystem: "exporter",
+		Name:      "db_tls_certificate_expiry_timestamp_seconds",
+		Help:      "Expiry of the certificates used to connect to SingleStore, by usage (client or ca)",
+	}, []string{"usage", "file", "subject"})
+)
+
+// dbTLS is the TLS config loaded from the files of db.tls, registered with the mysql driver as name.
+type dbTLS struct {
+	name   string
+	config *tls.Config
+	// expiries are published once the config is applied, by usage, file and subject
+	expiries map[[3]string]float64
+}
+
+// dbTLSRefs counts the states using each registered name, which is deregistered when the last of them is closed.
+// A state keeps its name until its in-flight scrapes are done, and the next state may share it.
+var dbTLSRefs = struct {
+	mu   sync.Mutex
+	refs map[string]int
+}{refs: make(map[string]int)}
+
+// loadDBTLS loads the files of cfg, without registering them.
+// The name is derived from the content, so a rotated certificate gets a new name
+// and pools are re-created on reload, while unchanged files keep the running pools.
+// It returns nil when TLS is not configured.
+func loadDBTLS(cfg config.DBTLSConfig) (*dbTLS, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	digest := sha256.New()
+	fmt.Fprintf(digest, "%s\x00%t\x00", cfg.ServerName, cfg.InsecureSkipVerify)
+
+	expiries := make(map[[3]string]float64)
+
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read db.tls.ca_file: path=%s err=%v", cfg.CAFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in db.tls.ca_file: path=%s", cfg.CAFile)
+		}
+		digest.Write(caPEM)
+
+		for _, cert := range parseCertificates(caPEM) {
+			expiries[[3]string{"ca", cfg.CAFile, cert.Subject.String()}] = float64(cert.NotAfter.Unix())
+		}
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		certPEM, err := os.ReadFile(cfg.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read db.tls.cert_file: path=%s err=%v", cfg.CertFile, err)
+		}
+		keyPEM, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read db.tls.key_file: path=%s err=%v", cfg.KeyFile, err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load db.tls.cert_file and db.tls.key_file: cert_file=%s key_file=%s err=%v", cfg.CertFile, cfg.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		digest.Write(certPEM)
+		digest.Write(keyPEM)
+
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			expiries[[3]string{"client", cfg.CertFile, leaf.Subject.String()}] = float64(leaf.NotAfter.Unix())
+		}
+	}
+
+	return &dbTLS{
+		name:     dbTLSConfigNamePrefix + hex.EncodeToString(digest.Sum(nil))[:16],
+		config:   tlsConfig,
+		expiries: expiries,
+	}, nil
+}
+
+// Name returns the name registered with the mysql driver, empty without TLS.
+func (t *dbTLS) Name() string {
+	if t == nil {
+		return ""
+	}
+	return t.name
+}
+
+// register registers the config with the mysql driver, or takes another reference to it
+// when a running state already uses the same files. Each call is paired with releaseDBTLS.
+func (t *dbTLS) register() error {
+	if t == nil {
+		return nil
+	}
+
+	dbTLSRefs.mu.Lock()
+	defer dbTLSRefs.mu.Unlock()
+
+	if dbTLSRefs.refs[t.name] == 0 {
+		if err := mysql.RegisterTLSConfig(t.name, t.config); err != nil {
+			return fmt.Errorf("failed to register db tls config: err=%v", err)
+		}
+	}
+	dbTLSRefs.refs[t.name]++
+	return nil
+}
+
+// publishExpiry replaces the expiries of the applied config. It is called once the reload can no longer fail.
+func (t *dbTLS) publishExpiry() {
+	dbTLSCertificateExpiry.Reset()
+	if t == nil {
+		return
+	}
+	for labels, expiry := range t.expiries {
+		dbTLSCertificateExpiry.WithLabelValues(labels[0], labels[1], labels[2]).Set(expiry)
+	}
+}
+
+// releaseDBTLS drops a reference taken by register, and deregisters the name when it was the last one.
+func releaseDBTLS(name string) {
+	if name == "" {
+		return
+	}
+
+	dbTLSRefs.mu.Lock()
+	defer dbTLSRefs.mu.Unlock()
+
+	dbTLSRefs.refs[name]--
+	if dbTLSRefs.refs[name] <= 0 {
+		delete(dbTLSRefs.refs, name)
+		mysql.DeregisterTLSConfig(name)
+	}
+}
+
+// useDBTLS makes cfg connect with the TLS config registered as name, over any tls parameter of the DSN.
+func useDBTLS(cfg *mysql.Config, name string) {
+	if name == "" {
+		return
+	}
+	cfg.TLS = nil
+	cfg.TLSConfig = name
+}
+
+func parseCertificates(b []byte) []*x509.Certificate {
+	certs := make([]*x509.Certificate, 0)
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"singlestore_exporter/config"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir, returning their paths.
+func writeCertificate(t *testing.T, dir string, name string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// registered tells whether the mysql driver knows the TLS config name.
+func registered(name string) bool {
+	_, err := mysql.ParseDSN("exporter@tcp(127.0.0.1:3306)/?tls=" + name)
+	return err == nil
+}
+
+func TestLoadDBTLS(t *testing.T) {
+	dir := t.TempDir()
+	expiry := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	caFile, _ := writeCertificate(t, dir, "ca", expiry)
+	certFile, keyFile := writeCertificate(t, dir, "client", expiry)
+	_, otherKeyFile := writeCertificate(t, dir, "other", expiry)
+
+	tt := []struct {
+		name             string
+		cfg              config.DBTLSConfig
+		expectedExpiries map[[3]string]float64
+		expectedErr      bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name: "ca only",
+			cfg:  config.DBTLSConfig{CAFile: caFile},
+			expectedExpiries: map[[3]string]float64{
+				{"ca", caFile, "CN=ca"}: float64(expiry.Unix()),
+			},
+		},
+		{
+			name: "client certificate",
+			cfg:  config.DBTLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+			expectedExpiries: map[[3]string]float64{
+				{"ca", caFile, "CN=ca"}:           float64(expiry.Unix()),
+				{"client", certFile, "CN=client"}: float64(expiry.Unix()),
+			},
+		},
+		{
+			name:        "mismatched key",
+			cfg:         config.DBTLSConfig{CertFile: certFile, KeyFile: otherKeyFile},
+			expectedErr: true,
+		},
+		{
+			name:        "ca file without a certificate",
+			cfg:         config.DBTLSConfig{CAFile: keyFile},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dbTLS, err := loadDBTLS(tc.cfg)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.expectedExpiries == nil {
+				assert.Nil(t, dbTLS)
+				assert.Empty(t, dbTLS.Name())
+				return
+			}
+			assert.Equal(t, tc.expectedExpiries, dbTLS.expiries)
+			// loading does not register anything, a failed reload leaves the driver untouched
+			assert.False(t, registered(dbTLS.Name()))
+		})
+	}
+}
+
+func TestDBTLSRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldCAFile, _ := writeCertificate(t, dir, "old", time.Now().Add(time.Hour))
+	newCAFile, _ := writeCertificate(t, dir, "new", time.Now().Add(48*time.Hour))
+
+	oldTLS, err := loadDBTLS(config.DBTLSConfig{CAFile: oldCAFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oldTLS.register(); err != nil {
+		t.Fatal(err)
+	}
+	oldTLS.publishExpiry()
+
+	// the same files keep the name, and share the registration
+	sameTLS, err := loadDBTLS(config.DBTLSConfig{CAFile: oldCAFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, oldTLS.Name(), sameTLS.Name())
+	if err := sameTLS.register(); err != nil {
+		t.Fatal(err)
+	}
+	releaseDBTLS(sameTLS.Name())
+	assert.True(t, registered(oldTLS.Name()))
+
+	// a rotated CA gets a new name, and the expiry of the old one is only replaced once published
+	newTLS, err := loadDBTLS(config.DBTLSConfig{CAFile: newCAFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, oldTLS.Name(), newTLS.Name())
+	if err := newTLS.register(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, testutil.CollectAndCount(dbTLSCertificateExpiry))
+	assert.Equal(t, oldTLS.expiries[[3]string{"ca", oldCAFile, "CN=old"}],
+		testutil.ToFloat64(dbTLSCertificateExpiry.WithLabelValues("ca", oldCAFile, "CN=old")))
+	newTLS.publishExpiry()
+	assert.Equal(t, 1, testutil.CollectAndCount(dbTLSCertificateExpiry))
+	assert.Equal(t, newTLS.expiries[[3]string{"ca", newCAFile, "CN=new"}],
+		testutil.ToFloat64(dbTLSCertificateExpiry.WithLabelValues("ca", newCAFile, "CN=new")))
+
+	// the old name is deregistered once the pools of the old state are closed
+	assert.True(t, registered(oldTLS.Name()))
+	releaseDBTLS(oldTLS.Name())
+	assert.False(t, registered(oldTLS.Name()))
+	assert.True(t, registered(newTLS.Name()))
+
+	releaseDBTLS(newTLS.Name())
+	assert.False(t, registered(newTLS.Name()))
+	assert.Empty(t, dbTLSRefs.refs)
+}
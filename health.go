@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"singlestore_exporter/collector"
+	"singlestore_exporter/log"
+)
+
+const (
+	// readyCheckTimeout limits the checks of /-/ready
+	readyCheckTimeout = 5 * time.Second
+)
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<html>
+<head><title>SingleStore Exporter</title></head>
+<body>
+<h1>SingleStore Exporter</h1>
+<p>version {{.Version}}</p>
+<ul>
+<li><a href="metrics">metrics</a></li>
+<li><a href="-/healthy">healthy</a></li>
+<li><a href="-/ready">ready</a></li>
+</ul>
+<h2>Enabled collectors</h2>
+<table>
+{{range .Registrations}}<tr><td>{{.Scraper.Name}}</td><td>{{.Scraper.Help}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// newLandingHandler lists the collectors enabled by the current config.
+func newLandingHandler(version string, reloader *reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		s := reloader.state()
+		registrations := make([]collector.Registration, 0, len(s.registrations))
+		for _, registration := range s.registrations {
+			// the same as collector.New, which skips them without a DSN
+			if registration.RequiresDSN && s.pool == nil {
+				continue
+			}
+			registrations = append(registrations, registration)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := landingTemplate.Execute(w, struct {
+			Version       string
+			Registrations []collector.Registration
+		}{
+			Version:       version,
+			Registrations: registrations,
+		})
+		if err != nil {
+			log.ErrorLogger.Errorf("failed to render landing page: err=%v", err)
+		}
+	}
+}
+
+// healthyHandler reports that the exporter is running, for liveness checks.
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Healthy\n"))
+}
+
+type readyCheck struct {
+	// Skipped is set when nothing enabled depends on the check
+	Skipped bool   `json:"skipped,omitempty"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+type readyStatus struct {
+	Ready  bool                  `json:"ready"`
+	Checks map[string]readyCheck `json:"checks"`
+}
+
+// newReadyHandler checks that the DSN can connect and that memsqlctl can be run.
+// A check is skipped when no enabled collector needs it, e.g. memsqlctl on an exporter which only probes.
+func newReadyHandler(reloader *reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := reloader.acquire()
+		defer s.release()
+
+		ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+		defer cancel()
+
+		status := readyStatus{
+			Ready: true,
+			Checks: map[string]readyCheck{
+				"dsn":       checkDSN(ctx, s),
+				"memsqlctl": checkMemsqlctl(ctx, s),
+			},
+		}
+		for _, check := range status.Checks {
+			if !check.Skipped && !check.OK {
+				status.Ready = false
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.ErrorLogger.Errorf("failed to write ready status: err=%v", err)
+		}
+	}
+}
+
+func checkDSN(ctx context.Context, s *state) readyCheck {
+	if s.pool == nil {
+		return readyCheck{Skipped: true, OK: true}
+	}
+	// a failed check must not delay the reconnection of scrapes
+	if err := s.pool.Check(ctx); err != nil {
+		return readyCheck{Error: err.Error()}
+	}
+	return readyCheck{OK: true}
+}
+
+func checkMemsqlctl(ctx context.Context, s *state) readyCheck {
+	needed := false
+	for _, registration := range s.registrations {
+		if registration.NodeLocal {
+			needed = true
+		}
+	}
+	if !needed {
+		return readyCheck{Skipped: true, OK: true}
+	}
+
+	if err := s.memsqlctl.Available(); err != nil {
+		return readyCheck{Error: err.Error()}
+	}
+	// runs list-nodes, e.g. to catch a prefix which is not allowed by sudo.
+	// Its result is shared for memsqlctl.inventory_ttl, so frequent checks do not run memsqlctl every time.
+	if _, err := s.memsqlctl.ListNodes(ctx); err != nil {
+		return readyCheck{Error: err.Error()}
+	}
+	return readyCheck{OK: true}
+}
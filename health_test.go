@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"singlestore_exporter/collector"
+	"singlestore_exporter/memsqlctl"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMemsqlctl lists no nodes, or fails with err.
+type fakeMemsqlctl struct {
+	err error
+}
+
+func (c fakeMemsqlctl) ListNodes(ctx context.Context) ([]memsqlctl.Node, error) {
+	return nil, c.err
+}
+
+func (c fakeMemsqlctl) Query(ctx context.Context, memsqlID string, sql string, rows interface{}) error {
+	return c.err
+}
+
+func (c fakeMemsqlctl) Available() error {
+	return nil
+}
+
+func TestReadyHandler(t *testing.T) {
+	// nothing listens on port 1, the connection is refused at once
+	unreachable := mysql.NewConfig()
+	unreachable.Net = "tcp"
+	unreachable.Addr = "127.0.0.1:1"
+
+	nodeLocal := []collector.Registration{{Scraper: namedScraper("nodes"), NodeLocal: true}}
+
+	tt := []struct {
+		name           string
+		pool           *collector.DBPool
+		memsqlctl      memsqlctl.Client
+		registrations  []collector.Registration
+		expectedCode   int
+		expectedStatus readyStatus
+	}{
+		{
+			name:         "skipped",
+			expectedCode: http.StatusOK,
+			expectedStatus: readyStatus{
+				Ready: true,
+				Checks: map[string]readyCheck{
+					"dsn":       {Skipped: true, OK: true},
+					"memsqlctl": {Skipped: true, OK: true},
+				},
+			},
+		},
+		{
+			name:          "ready",
+			memsqlctl:     fakeMemsqlctl{},
+			registrations: nodeLocal,
+			expectedCode:  http.StatusOK,
+			expectedStatus: readyStatus{
+				Ready: true,
+				Checks: map[string]readyCheck{
+					"dsn":       {Skipped: true, OK: true},
+					"memsqlctl": {OK: true},
+				},
+			},
+		},
+		{
+			name:          "not ready",
+			pool:          collector.NewDBPool(unreachable, collector.DBPoolOptions{}),
+			memsqlctl:     fakeMemsqlctl{err: errors.New("sudo: a password is required")},
+			registrations: nodeLocal,
+			expectedCode:  http.StatusServiceUnavailable,
+			expectedStatus: readyStatus{
+				Ready: false,
+				Checks: map[string]readyCheck{
+					"dsn":       {},
+					"memsqlctl": {Error: "sudo: a password is required"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &reloader{}
+			r.current.Store(&state{
+				pool:          tc.pool,
+				memsqlctl:     tc.memsqlctl,
+				registrations: tc.registrations,
+			})
+
+			rec := httptest.NewRecorder()
+			newReadyHandler(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/ready", nil))
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			var status readyStatus
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+			if check := status.Checks["dsn"]; !check.OK {
+				// the error of the driver depends on the platform
+				assert.NotEmpty(t, check.Error)
+				status.Checks["dsn"] = readyCheck{}
+			}
+			assert.Equal(t, tc.expectedStatus, status)
+
+			if tc.pool != nil {
+				// the failed check leaves the backoff of scrapes alone
+				_, err := tc.pool.DB(context.Background())
+				assert.NotContains(t, err.Error(), "waiting")
+			}
+		})
+	}
+}
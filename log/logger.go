@@ -3,6 +3,7 @@ package log
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
@@ -13,6 +14,12 @@ type LogrusLogger struct {
 	*logrus.Entry
 }
 
+var (
+	outputsMu sync.Mutex
+	// outputs holds the rotating file of each file logger, to be closed on reload
+	outputs = make(map[*logrus.Logger]*lumberjack.Logger)
+)
+
 var ErrorLogger *LogrusLogger
 var SlowQueryLogger *LogrusLogger
 
@@ -42,6 +49,47 @@ func InitLoggers(logPath string, logLevel string, slowQueryLogPath string) error
 	return nil
 }
 
+// ReloadLoggers changes the level and the output of the loggers created by InitLoggers in place,
+// so that goroutines holding them keep working.
+func ReloadLoggers(logPath string, logLevel string, slowQueryLogPath string) error {
+	level, err := getLogLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	reloadLogger(ErrorLogger.Logger, logPath, level)
+	reloadLogger(SlowQueryLogger.Logger, slowQueryLogPath, level)
+
+	return nil
+}
+
+func reloadLogger(logger *logrus.Logger, path string, level logrus.Level) {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+
+	logger.SetLevel(level)
+
+	old := outputs[logger]
+	if old != nil && old.Filename == path {
+		return
+	}
+
+	if path != "" {
+		lum := newRotatingFile(logger, path)
+		logger.SetOutput(lum)
+		outputs[logger] = lum
+	} else {
+		logger.SetOutput(os.Stderr)
+		delete(outputs, logger)
+	}
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			logger.Errorf("Failed to close log file: %s", err)
+		}
+	}
+}
+
 func NewConsoleLogger(formatJSON bool, level logrus.Level) *LogrusLogger {
 	logger := logrus.New()
 	logger.SetLevel(level)
@@ -71,22 +119,13 @@ func NewFileLogger(path string, formatJSON bool, level logrus.Level) *LogrusLogg
 	logger := logrus.New()
 	logger.SetLevel(level)
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644); err != nil {
-			logger.Errorf("Failed to open log file: %s", err)
-		} else {
-			file.Close()
-		}
-	}
-
-	lum := &lumberjack.Logger{
-		Filename:   path,
-		MaxSize:    100, // megabytes
-		MaxBackups: 3,
-		MaxAge:     3,
-	}
+	lum := newRotatingFile(logger, path)
 	logger.SetOutput(lum)
 
+	outputsMu.Lock()
+	outputs[logger] = lum
+	outputsMu.Unlock()
+
 	if formatJSON {
 		logger.SetFormatter(&logrus.JSONFormatter{})
 	} else {
@@ -108,6 +147,23 @@ func NewFileLogger(path string, formatJSON bool, level logrus.Level) *LogrusLogg
 	return &LogrusLogger{entry}
 }
 
+func newRotatingFile(logger *logrus.Logger, path string) *lumberjack.Logger {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			logger.Errorf("Failed to open log file: %s", err)
+		} else {
+			file.Close()
+		}
+	}
+
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    100, // megabytes
+		MaxBackups: 3,
+		MaxAge:     3,
+	}
+}
+
 func getLogLevel(level string) (logrus.Level, error) {
 	switch level {
 	case "debug":
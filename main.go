@@ -7,12 +7,17 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"singlestore_exporter/collector"
+	"singlestore_exporter/config"
 	"singlestore_exporter/log"
+	"singlestore_exporter/memsqlctl"
+	"singlestore_exporter/web"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,21 +27,68 @@ var Version string
 var versionFlag = flag.Bool("version", false, "print the version")
 
 func main() {
+	flagConfigFilePtr := flag.String("config.file", "", "path to the YAML config file. Its settings override the flags, and it is reloaded on SIGHUP or POST /-/reload")
+
 	flagListenAddress := flag.String("net.listen_address", "0.0.0.0:9105", "network address on which the exporter listens")
+	flagWebConfigFilePtr := flag.String("web.config.file", "", "path to the web config file enabling TLS and basic auth. It is reloaded together with --config.file")
+	flagShutdownTimeoutPtr := flag.Duration("net.shutdown_timeout", 10*time.Second, "how long in-flight scrapes may take to finish on shutdown")
 	flagPprof := flag.Bool("debug.pprof", false, "enable pprof")
+	flagTimeoutOffsetPtr := flag.Duration("scrape.timeout_offset", 250*time.Millisecond, "offset to subtract from the scrape timeout sent by Prometheus")
+	flagMinIntervalPtr := flag.Duration("scrape.min_interval", 0, "serve the last scrape from cache until it is older than this, 0 to always scrape")
 
-	flagReplicationStatusPtr := flag.Bool("collect.replication_status", false, "collect replication status")
+	// --collect.<name> flags are generated from the scraper registry
+	collectFlags := make(map[string]*bool)
+	for _, registration := range collector.Registry(&collector.ScraperOptions{}) {
+		name := registration.Scraper.Name()
+		collectFlags[name] = flag.Bool("collect."+name, registration.EnabledByDefault, registration.Scraper.Help())
+	}
 
-	flagSlowQueryPtr := flag.Bool("collect.slow_query", false, "collect slow query")
 	flagSlowQueryThresholdPtr := flag.Int("collect.slow_query.threshold", 10, "slow query threshold in seconds")
 	flagSlowQueryLogPathPtr := flag.String("collect.slow_query.log_path", "", "slow query log path")
 	flagSlowQueryExceptionHostsPtr := flag.String("collect.slow_query.exception.hosts", "", "slow query exception patterns host")
 	flagSlowQueryExceptionInfoPatternsPtr := flag.String("collect.slow_query.exception.info.patterns", "", "slow query exception patterns info")
+	flagSlowQueryExceptionUsersPtr := flag.String("collect.slow_query.exception.users", "", "comma-separated users excluded from slow queries")
+	flagSlowQueryExceptionDBsPtr := flag.String("collect.slow_query.exception.dbs", "", "comma-separated databases excluded from slow queries")
+	flagSlowQueryExceptionCommandsPtr := flag.String("collect.slow_query.exception.commands", "", "comma-separated commands excluded from slow queries")
+	flagSlowQueryExceptionResourcePoolsPtr := flag.String("collect.slow_query.exception.resource_pools", "", "comma-separated resource pools excluded from slow queries")
+
+	flagNodesSourcePtr := flag.String("collect.nodes.source", "memsqlctl", "source of node state: memsqlctl, sql (SHOW LEAVES and SHOW AGGREGATORS of the aggregator), or auto")
 
-	flagDataDiskUsagePtr := flag.Bool("collect.data_disk_usage", false, "collect data disk usage")
 	flagDataDiskUsageScrapeIntervalPtr := flag.Int("collect.data_disk_usage.scrape_interval", 30, "data disk usage scrape interval in seconds")
+	flagDataDiskUsageParallelismPtr := flag.Int("collect.data_disk_usage.parallelism", 4, "maximum number of nodes whose data disk usage is queried at once")
+	flagDataDiskUsageCommandTimeoutPtr := flag.Duration("collect.data_disk_usage.command_timeout", 10*time.Second, "timeout of every memsqlctl command of data disk usage")
+
+	flagActivitiesTopQueriesPtr := flag.Int("collect.activities.top_queries", 20, "number of queries with their own query label in activity metrics, the others are summed up as other")
+
+	flagPlanCacheTopPlansPtr := flag.Int("collect.plancache.top_plans", 20, "number of plans with their own series in plan cache metrics, the others are summed up as other")
+	flagPlanCacheRankingPtr := flag.String("collect.plancache.ranking", "execution_time", "ranking of the top plans: execution_time, executions, rows, average_execution_time or memory")
+
+	flagGlobalStatusAllowlistPtr := flag.String("collect.global_status.allowlist", "", "comma-separated regexps of the lower case names of status variables without a known type, exported as untyped")
+
+	flagGlobalVariablesInfoAllowlistPtr := flag.String("collect.global_variables.info_allowlist", "", "comma-separated regexps of the lower case names of variables which are not numbers, exported as singlestore_variable_info")
+
+	flagMemorySourcePtr := flag.String("collect.memory.source", "auto", "source of memory: sql (MV_GLOBAL_STATUS of the aggregator), memsqlctl (SHOW STATUS EXTENDED of the local nodes), or auto which uses sql when a DSN is configured")
+
+	flagDSNCredentialsFilePtr := flag.String("dsn.credentials_file", "", "my.cnf-style file with a [client] section, used when DATA_SOURCE_NAME is not set")
+	flagDSNPasswordFilePtr := flag.String("dsn.password_file", "", "file holding the password of the aggregator, re-read on every new connection")
 
-	flagActiveTransactionPtr := flag.Bool("collect.active_transaction", false, "collect active transaction")
+	flagMemsqlctlPathPtr := flag.String("memsqlctl.path", memsqlctl.DefaultPath, "path of the memsqlctl binary")
+	flagMemsqlctlPrefixPtr := flag.String("memsqlctl.prefix", "", "comma-separated command prepended to memsqlctl, e.g. sudo,-n,-u,memsql")
+	flagMemsqlctlTimeoutPtr := flag.Duration("memsqlctl.timeout", 30*time.Second, "timeout of every memsqlctl command")
+	flagMemsqlctlInventoryTTLPtr := flag.Duration("memsqlctl.inventory_ttl", 5*time.Second, "how long the output of memsqlctl list-nodes is shared by the collectors")
+
+	flagDBMaxOpenConnsPtr := flag.Int("db.max_open_conns", 3, "maximum number of open connections to the aggregator")
+	flagDBMaxIdleConnsPtr := flag.Int("db.max_idle_conns", 3, "maximum number of idle connections to the aggregator")
+	flagDBConnMaxLifetimePtr := flag.Duration("db.conn_max_lifetime", 1*time.Minute, "maximum amount of time a connection to the aggregator may be reused")
+
+	flagDBTLSCAFilePtr := flag.String("db.tls.ca_file", "", "CA bundle verifying the certificate of SingleStore, turns on TLS")
+	flagDBTLSCertFilePtr := flag.String("db.tls.cert_file", "", "client certificate presented to SingleStore, turns on TLS")
+	flagDBTLSKeyFilePtr := flag.String("db.tls.key_file", "", "key of the client certificate")
+	flagDBTLSServerNamePtr := flag.String("db.tls.server_name", "", "server name verified instead of the host of the DSN, turns on TLS")
+	flagDBTLSInsecureSkipVerifyPtr := flag.Bool("db.tls.insecure_skip_verify", false, "skip the verification of the certificate of SingleStore, turns on TLS")
+
+	flagProbeMaxTargetsPtr := flag.Int("probe.max_targets", 100, "maximum number of connection pools kept open for /probe, one per target and auth module")
+	flagProbeIdleTimeoutPtr := flag.Duration("probe.idle_timeout", 10*time.Minute, "close the connection pool of a /probe target which was not probed for this long")
 
 	flagLogPathPtr := flag.String("log.log_path", "", "singlestore_exporter log path")
 	flagLogLevel := flag.String("log.level", "info", "log level (default: info)")
@@ -47,43 +99,152 @@ func main() {
 		return
 	}
 
-	slowQueryExceptionHosts := make([]string, 0)
-	if *flagSlowQueryExceptionHostsPtr != "" {
-		slowQueryExceptionHosts = strings.Split(*flagSlowQueryExceptionHostsPtr, ",")
-	}
-	slowQueryExceptionInfoPatterns := make([]string, 0)
-	if *flagSlowQueryExceptionInfoPatternsPtr != "" {
-		slowQueryExceptionInfoPatterns = strings.Split(*flagSlowQueryExceptionInfoPatternsPtr, ",")
+	// the flags are the defaults of the config, and are re-applied before the config file on every reload
+	defaults := func() *config.Config {
+
+		collectors := make(config.Collectors, len(collectFlags))
+		for name, enabled := range collectFlags {
+			collectors[name] = config.CollectorConfig{Enabled: *enabled}
+		}
+		// data_disk_usage is too slow to be run on every scrape
+		collectors["data_disk_usage"] = config.CollectorConfig{
+			Enabled:            *collectFlags["data_disk_usage"],
+			BackgroundInterval: time.Duration(*flagDataDiskUsageScrapeIntervalPtr) * time.Second,
+		}
+
+		return &config.Config{
+			Web: config.WebConfig{
+				ListenAddress:   *flagListenAddress,
+				ShutdownTimeout: *flagShutdownTimeoutPtr,
+			},
+			Scrape: config.ScrapeConfig{
+				TimeoutOffset: *flagTimeoutOffsetPtr,
+				MinInterval:   *flagMinIntervalPtr,
+			},
+			Log: config.LogConfig{
+				Path:  *flagLogPathPtr,
+				Level: *flagLogLevel,
+			},
+			DSN: config.DSNConfig{
+				// only aggregator node need DSN
+				Env:             "DATA_SOURCE_NAME",
+				CredentialsFile: *flagDSNCredentialsFilePtr,
+				PasswordFile:    *flagDSNPasswordFilePtr,
+			},
+			DB: config.DBConfig{
+				MaxOpenConns:    *flagDBMaxOpenConnsPtr,
+				MaxIdleConns:    *flagDBMaxIdleConnsPtr,
+				ConnMaxLifetime: *flagDBConnMaxLifetimePtr,
+				TLS: config.DBTLSConfig{
+					CAFile:             *flagDBTLSCAFilePtr,
+					CertFile:           *flagDBTLSCertFilePtr,
+					KeyFile:            *flagDBTLSKeyFilePtr,
+					ServerName:         *flagDBTLSServerNamePtr,
+					InsecureSkipVerify: *flagDBTLSInsecureSkipVerifyPtr,
+				},
+			},
+			Collectors: collectors,
+			SlowQuery: config.SlowQueryConfig{
+				Threshold:              *flagSlowQueryThresholdPtr,
+				LogPath:                *flagSlowQueryLogPathPtr,
+				ExceptionHosts:         splitFlag(*flagSlowQueryExceptionHostsPtr),
+				ExceptionInfoPatterns:  splitFlag(*flagSlowQueryExceptionInfoPatternsPtr),
+				ExceptionInfoRegexps:   make([]string, 0),
+				ExceptionUsers:         splitFlag(*flagSlowQueryExceptionUsersPtr),
+				ExceptionDBs:           splitFlag(*flagSlowQueryExceptionDBsPtr),
+				ExceptionCommands:      splitFlag(*flagSlowQueryExceptionCommandsPtr),
+				ExceptionResourcePools: splitFlag(*flagSlowQueryExceptionResourcePoolsPtr),
+			},
+			Nodes: config.NodesConfig{
+				Source: *flagNodesSourcePtr,
+			},
+			DataDiskUsage: config.DataDiskUsageConfig{
+				Parallelism:    *flagDataDiskUsageParallelismPtr,
+				CommandTimeout: *flagDataDiskUsageCommandTimeoutPtr,
+			},
+			Memsqlctl: config.MemsqlctlConfig{
+				Path:         *flagMemsqlctlPathPtr,
+				Prefix:       splitFlag(*flagMemsqlctlPrefixPtr),
+				Timeout:      *flagMemsqlctlTimeoutPtr,
+				InventoryTTL: *flagMemsqlctlInventoryTTLPtr,
+			},
+			Activities: config.ActivitiesConfig{
+				TopQueries: *flagActivitiesTopQueriesPtr,
+			},
+			PlanCache: config.PlanCacheConfig{
+				TopPlans: *flagPlanCacheTopPlansPtr,
+				Ranking:  *flagPlanCacheRankingPtr,
+			},
+			GlobalStatus: config.GlobalStatusConfig{
+				Allowlist: splitFlag(*flagGlobalStatusAllowlistPtr),
+			},
+			GlobalVariables: config.GlobalVariablesConfig{
+				InfoAllowlist: splitFlag(*flagGlobalVariablesInfoAllowlistPtr),
+			},
+			Memory: config.MemoryConfig{
+				Source: *flagMemorySourcePtr,
+			},
+			Debug: config.DebugConfig{
+				Pprof: *flagPprof,
+			},
+			Probe: config.ProbeConfig{
+				MaxTargets:  *flagProbeMaxTargetsPtr,
+				IdleTimeout: *flagProbeIdleTimeoutPtr,
+			},
+		}
 	}
 
-	if err := log.InitLoggers(*flagLogPathPtr, *flagLogLevel, *flagSlowQueryLogPathPtr); err != nil {
+	cfg := defaults()
+	if err := config.LoadFile(*flagConfigFilePtr, cfg); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	// only aggregator node need DSN
-	dsn := os.Getenv("DATA_SOURCE_NAME")
+	if err := log.InitLoggers(cfg.Log.Path, cfg.Log.Level, cfg.SlowQuery.LogPath); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	// scrape data_disk_usage in separate goroutine, because query execution time is too long (> 1s)
-	if *flagDataDiskUsagePtr {
-		ticker := time.Tick(time.Duration(*flagDataDiskUsageScrapeIntervalPtr) * time.Second)
-		go func() {
-			for range ticker {
-				collector.ScrapeDataDiskUsages()
-			}
-		}()
+	webServer, err := web.NewServer(*flagWebConfigFilePtr)
+	if err != nil {
+		log.ErrorLogger.Errorf("failed to load web config: err=%v", err)
+		os.Exit(1)
 	}
 
-	flags := &collector.ExporterFlags{
-		FlagSlowQuery:                      *flagSlowQueryPtr,
-		FlagSlowQueryThreshold:             *flagSlowQueryThresholdPtr,
-		FlagReplicationStatus:              *flagReplicationStatusPtr,
-		FlagDataDiskUsage:                  *flagDataDiskUsagePtr,
-		FlagActiveTransactionPtr:           *flagActiveTransactionPtr,
-		FlagSlowQueryExceptionHosts:        slowQueryExceptionHosts,
-		FlagSlowQueryExceptionInfoPatterns: slowQueryExceptionInfoPatterns,
+	// ctx is cancelled on SIGINT or SIGTERM, and stops the background collectors
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	reloader := newReloader(ctx, *flagConfigFilePtr, defaults, webServer)
+	if err := reloader.Reload(); err != nil {
+		log.ErrorLogger.Errorf("failed to load config: err=%v", err)
+		os.Exit(1)
 	}
 
+	prometheus.MustRegister(
+		configReloadSuccess,
+		configReloadSeconds,
+		dbTLSCertificateExpiry,
+		scrapesTotal,
+		poolCollector{reloader},
+	)
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := reloader.Reload(); err != nil {
+					log.ErrorLogger.Errorf("failed to reload config, keeping the previous one: err=%v", err)
+				}
+			}
+		}
+	}()
+
 	mux := http.NewServeMux()
 	mux.Handle(
 		"/metrics",
@@ -91,54 +252,121 @@ func main() {
 			prometheus.DefaultRegisterer,
 			newHandler(
 				Version,
-				dsn,
-				flags,
+				reloader,
 			),
 		),
 	)
 
-	// pprof
-	if *flagPprof {
-		mux.HandleFunc("/debug/pprof/", pprof.Index)
-		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle(
+		"/probe",
+		newProbeHandler(
+			Version,
+			reloader,
+		),
+	)
+
+	mux.Handle("/", newLandingHandler(Version, reloader))
+	mux.HandleFunc("/-/healthy", healthyHandler)
+	mux.Handle("/-/ready", newReadyHandler(reloader))
+
+	mux.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reloader.Reload(); err != nil {
+			log.ErrorLogger.Errorf("failed to reload config, keeping the previous one: err=%v", err)
+			http.Error(w, fmt.Sprintf("failed to reload config: %v", err), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "config reloaded")
+	})
+
+	// pprof, can be turned on and off by reloading the config
+	pprofHandler := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !reloader.state().cfg.Debug.Pprof {
+				http.NotFound(w, r)
+				return
+			}
+			h(w, r)
+		}
 	}
+	mux.HandleFunc("/debug/pprof/", pprofHandler(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", pprofHandler(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", pprofHandler(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", pprofHandler(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", pprofHandler(pprof.Trace))
 
-	log.ErrorLogger.Infof("listening on %s", *flagListenAddress)
-	if err := http.ListenAndServe(*flagListenAddress, mux); err != nil {
-		panic(err)
+	server := &http.Server{
+		Addr:    cfg.Web.ListenAddress,
+		Handler: mux,
 	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.ErrorLogger.Infof("listening on %s", cfg.Web.ListenAddress)
+		serverErr <- webServer.ListenAndServe(server)
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.ErrorLogger.Errorf("failed to serve: err=%v", err)
+		reloader.Close()
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// a second SIGINT or SIGTERM kills the exporter, e.g. when the shutdown hangs
+	stop()
+
+	// stop accepting requests, and give in-flight scrapes time to finish
+	shutdownTimeout := reloader.state().cfg.Web.ShutdownTimeout
+	log.ErrorLogger.Infof("shutting down: timeout=%s", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.ErrorLogger.Warnf("in-flight scrapes did not finish in time, closing their connections: err=%v", err)
+		if err := server.Close(); err != nil {
+			log.ErrorLogger.Errorf("failed to close server: err=%v", err)
+		}
+	}
+
+	reloader.Close()
+	log.ErrorLogger.Infof("shutdown complete")
 }
 
 func newHandler(
 	version string,
-	dsn string,
-	flags *collector.ExporterFlags,
+	reloader *reloader,
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		s := reloader.acquire()
+		defer s.release()
 		registry := prometheus.NewRegistry()
 
-		ctx := r.Context()
-		timeoutSeconds, err := getScrapeTimeoutSeconds(r)
-		if err != nil {
-			log.ErrorLogger.Infof("Error getting timeout from Prometheus header: err=%v", err)
-		} else if timeoutSeconds > 0 {
-			var cancel context.CancelFunc
-			ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutSeconds*float64(time.Second)))
-			defer cancel()
-			r = r.WithContext(ctx)
-		}
+		ctx, cancel := scrapeContext(r, s.cfg.Scrape.TimeoutOffset)
+		defer cancel()
+		r = r.WithContext(ctx)
 
-		registry.MustRegister(
-			collector.New(
-				ctx,
-				version,
-				dsn,
-				flags,
-			),
+		registrations := selectRegistrations(s.registrations, r)
+		metrics, result, ok := s.scrapes.scrape(
+			ctx,
+			scrapeKey("metrics", registrations),
+			// the scrape may be shared with concurrent requests, and must not end with this one
+			func(scrapeCtx context.Context) prometheus.Collector {
+				return collector.New(
+					scrapeCtx,
+					version,
+					s.pool,
+					registrations,
+				)
+			},
 		)
+		if !ok {
+			http.Error(w, "timed out waiting for a concurrent scrape", http.StatusServiceUnavailable)
+			return
+		}
+		registry.MustRegister(metricsCollector{metrics, result})
 
 		gatherers := prometheus.Gatherers{
 			prometheus.DefaultGatherer,
@@ -150,6 +378,64 @@ func newHandler(
 	}
 }
 
+// splitFlag splits a comma-separated flag, an empty flag being an empty list
+func splitFlag(value string) []string {
+	if value == "" {
+		return make([]string, 0)
+	}
+	return strings.Split(value, ",")
+}
+
+// selectRegistrations limits the scrape to the collectors named by collect[] URL parameters,
+// e.g. /metrics?collect[]=pipeline&collect[]=cached_blobs. Only collectors enabled in the config can be selected.
+// Without collect[] parameters every enabled collector is scraped.
+func selectRegistrations(registrations []collector.Registration, r *http.Request) []collector.Registration {
+	collect := r.URL.Query()["collect[]"]
+	if len(collect) == 0 {
+		return registrations
+	}
+
+	enabled := make(map[string]collector.Registration, len(registrations))
+	for _, registration := range registrations {
+		enabled[registration.Scraper.Name()] = registration
+	}
+
+	selected := make([]collector.Registration, 0, len(collect))
+	seen := make(map[string]bool, len(collect))
+	for _, name := range collect {
+		registration, exists := enabled[name]
+		if !exists {
+			// not a warning, Prometheus sends the same collect[] on every scrape
+			log.ErrorLogger.Debugf("collector is not enabled, ignoring it: collect[]=%s", name)
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		selected = append(selected, registration)
+	}
+	return selected
+}
+
+// scrapeContext limits the request context to the scrape timeout sent by Prometheus minus offset.
+// Collectors which are still running at the deadline are abandoned, and the others are returned.
+func scrapeContext(r *http.Request, offset time.Duration) (context.Context, context.CancelFunc) {
+	timeoutSeconds, err := getScrapeTimeoutSeconds(r)
+	if err != nil {
+		log.ErrorLogger.Infof("Error getting timeout from Prometheus header: err=%v", err)
+	} else if timeoutSeconds > 0 {
+		timeout := time.Duration(timeoutSeconds * float64(time.Second))
+		if timeout > offset {
+			timeout -= offset
+		} else {
+			log.ErrorLogger.Warnf("scrape timeout is not longer than the timeout offset, ignoring the offset: timeout=%s offset=%s", timeout, offset)
+		}
+		return context.WithTimeout(r.Context(), timeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
 // {"level":"info","msg":"Headers: map[Accept:[text/plain;version=0.0.4;q=1,*/*;q=0.1] Accept-Encoding:[gzip] User-Agent:[vm_promscrape] X-Prometheus-Scrape-Timeout-Seconds:[5.000]]","time":"2024-10-31T10:42:53+09:00"}
 func getScrapeTimeoutSeconds(r *http.Request) (float64, error) {
 	var timeoutSeconds float64
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"singlestore_exporter/collector"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectRegistrations(t *testing.T) {
+	registrations := []collector.Registration{
+		{Scraper: namedScraper("nodes")},
+		{Scraper: namedScraper("pipeline")},
+		{Scraper: namedScraper("cached_blobs")},
+	}
+
+	tt := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "every enabled collector without collect[]",
+			query:    "",
+			expected: []string{"nodes", "pipeline", "cached_blobs"},
+		},
+		{
+			name:     "selected collectors in the order of the request",
+			query:    "collect[]=cached_blobs&collect[]=nodes",
+			expected: []string{"cached_blobs", "nodes"},
+		},
+		{
+			name:     "duplicates are scraped once",
+			query:    "collect[]=pipeline&collect[]=pipeline",
+			expected: []string{"pipeline"},
+		},
+		{
+			name:     "unknown and disabled collectors are ignored",
+			query:    "collect[]=unknown&collect[]=nodes",
+			expected: []string{"nodes"},
+		},
+		{
+			name:     "nothing is scraped when only unknown collectors are selected",
+			query:    "collect[]=unknown",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics?"+tc.query, nil)
+			names := make([]string, 0)
+			for _, registration := range selectRegistrations(registrations, r) {
+				names = append(names, registration.Scraper.Name())
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package memsqlctl
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killProcessGroup only kills memsqlctl itself, process groups are specific to unix.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = time.Second
+}
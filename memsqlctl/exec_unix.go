@@ -0,0 +1,20 @@
+//go:build unix
+
+package memsqlctl
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killProcessGroup runs cmd in its own process group, and kills the whole group on cancel,
+// including children which memsqlctl or the prefix (e.g. sudo) started.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// do not wait forever for output pipes held open by an orphan
+	cmd.WaitDelay = time.Second
+}
@@ -0,0 +1,67 @@
+package memsqlctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Fake is a Client for tests, answering from its fields instead of running memsqlctl.
+type Fake struct {
+	mu sync.Mutex
+
+	Nodes        []Node
+	ListNodesErr error
+	// QueryRows holds the JSON rows returned by Query per memsql ID
+	QueryRows map[string]string
+	// QueryErrs fails Query for a memsql ID
+	QueryErrs map[string]error
+	// QueryFunc answers Query instead of QueryRows and QueryErrs when set, e.g. depending on the SQL
+	QueryFunc    func(memsqlID string, sql string) (string, error)
+	AvailableErr error
+
+	// Calls counts the calls per method
+	Calls map[string]int
+}
+
+func (f *Fake) called(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Calls == nil {
+		f.Calls = make(map[string]int)
+	}
+	f.Calls[method]++
+}
+
+func (f *Fake) ListNodes(ctx context.Context) ([]Node, error) {
+	f.called("ListNodes")
+	if f.ListNodesErr != nil {
+		return nil, f.ListNodesErr
+	}
+	return f.Nodes, nil
+}
+
+func (f *Fake) Query(ctx context.Context, memsqlID string, sql string, rows interface{}) error {
+	f.called("Query")
+	if f.QueryFunc != nil {
+		out, err := f.QueryFunc(memsqlID, sql)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(out), rows)
+	}
+	if err := f.QueryErrs[memsqlID]; err != nil {
+		return err
+	}
+	out, exists := f.QueryRows[memsqlID]
+	if !exists {
+		return fmt.Errorf("no rows for node: memsql_id=%s", memsqlID)
+	}
+	return json.Unmarshal([]byte(out), rows)
+}
+
+func (f *Fake) Available() error {
+	f.called("Available")
+	return f.AvailableErr
+}
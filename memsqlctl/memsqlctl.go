@@ -0,0 +1,155 @@
+package memsqlctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPath = "/usr/bin/memsqlctl"
+)
+
+type Node struct {
+	MemsqlId          string `json:"memsqlId"`
+	Role              string `json:"role"`
+	Port              int    `json:"port"`
+	ProcessState      string `json:"processState"`
+	IsConnectable     bool   `json:"isConnectable"`
+	Version           string `json:"version"`
+	RecoveryState     string `json:"recoveryState"`
+	AvailabilityGroup int    `json:"availabilityGroup"`
+	BindAddress       string `json:"bindAddress"`
+	NodeID            string `json:"nodeID"`
+	// Host is only known for nodes listed by SQL, which covers every host of the cluster
+	Host string `json:"-"`
+}
+
+type Nodes struct {
+	Nodes []Node `json:"nodes"`
+}
+
+// Client runs memsqlctl on the host of the exporter.
+type Client interface {
+	// ListNodes returns the nodes installed on the host
+	ListNodes(ctx context.Context) ([]Node, error)
+	// Query runs sql on the node memsqlID, and decodes the rows of the result into rows
+	Query(ctx context.Context, memsqlID string, sql string, rows interface{}) error
+	// Available returns an error when memsqlctl can not be run
+	Available() error
+}
+
+type Options struct {
+	// Path of the memsqlctl binary, DefaultPath when empty
+	Path string
+	// Prefix is prepended to every command, e.g. sudo -n -u memsql
+	Prefix []string
+	// Timeout limits every command, zero means it is only limited by the context
+	Timeout time.Duration
+	// InventoryTTL is how long the result of list-nodes is shared, zero runs it on every call
+	InventoryTTL time.Duration
+}
+
+// CLI runs the memsqlctl binary. Commands run in their own process group,
+// which is killed as a whole when the context is done, so that no child is left behind.
+type CLI struct {
+	opts Options
+
+	// inventoryMu serializes list-nodes, so that concurrent callers share one run
+	inventoryMu sync.Mutex
+	nodes       []Node
+	listedAt    time.Time
+}
+
+func NewCLI(opts Options) *CLI {
+	if opts.Path == "" {
+		opts.Path = DefaultPath
+	}
+	return &CLI{
+		opts: opts,
+	}
+}
+
+func (c *CLI) ListNodes(ctx context.Context) ([]Node, error) {
+	c.inventoryMu.Lock()
+	defer c.inventoryMu.Unlock()
+
+	if c.nodes != nil && time.Since(c.listedAt) < c.opts.InventoryTTL {
+		return c.nodes, nil
+	}
+
+	var nodes Nodes
+	if err := c.run(ctx, &nodes, "list-nodes", "--json", "--yes"); err != nil {
+		return nil, err
+	}
+
+	c.nodes = nodes.Nodes
+	c.listedAt = time.Now()
+	return c.nodes, nil
+}
+
+func (c *CLI) Query(ctx context.Context, memsqlID string, sql string, rows interface{}) error {
+	result := struct {
+		Rows interface{} `json:"rows"`
+	}{
+		Rows: rows,
+	}
+	return c.run(ctx, &result, "query", "--memsql-id", memsqlID, "--sql", sql, "--json")
+}
+
+func (c *CLI) Available() error {
+	if len(c.opts.Prefix) != 0 {
+		// the binary may only be readable through the prefix, e.g. by sudo
+		if _, err := exec.LookPath(c.opts.Prefix[0]); err != nil {
+			return err
+		}
+		if _, err := os.Stat(c.opts.Path); err != nil && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+		return nil
+	}
+	_, err := exec.LookPath(c.opts.Path)
+	return err
+}
+
+// run executes memsqlctl with args, and decodes its JSON output into v.
+func (c *CLI) run(ctx context.Context, v interface{}, args ...string) error {
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+
+	argv := make([]string, 0, len(c.opts.Prefix)+1+len(args))
+	argv = append(argv, c.opts.Prefix...)
+	argv = append(argv, c.opts.Path)
+	argv = append(argv, args...)
+	command := strings.Join(argv, " ")
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	killProcessGroup(cmd)
+
+	out, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr = exitErr.Stderr
+		}
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%v: %v", ctx.Err(), err)
+		}
+		return fmt.Errorf("scraping command failed: command='%s' out=%s stderr=%s error=%v", command, string(out), string(stderr), err)
+	}
+
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("unmarshal output failed: command='%s' out=%s error=%v", command, string(out), err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+//go:build unix
+
+package memsqlctl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeScript writes an executable shell script standing in for memsqlctl
+func writeScript(t *testing.T, dir string, name string, body string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCLI(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+
+	// logs its arguments, and answers list-nodes and query
+	memsqlctl := writeScript(t, dir, "memsqlctl", `
+echo "$@" >> `+calls+`
+case "$1" in
+list-nodes) echo '{"nodes": [{"memsqlId": "ABC", "role": "Master", "port": 3306, "processState": "Running"}]}' ;;
+query) echo '{"rows": [{"VALUE": "42"}]}' ;;
+*) echo "unknown command" >&2; exit 1 ;;
+esac
+`)
+	prefix := writeScript(t, dir, "prefix", `
+echo "prefix" >> `+calls+`
+exec "$@"
+`)
+
+	tt := []struct {
+		name          string
+		opts          Options
+		run           func(t *testing.T, c *CLI) error
+		expectedErr   bool
+		expectedCalls []string
+	}{
+		{
+			name: "list nodes",
+			opts: Options{Path: memsqlctl},
+			run: func(t *testing.T, c *CLI) error {
+				nodes, err := c.ListNodes(context.Background())
+				assert.Equal(t, []Node{{MemsqlId: "ABC", Role: "Master", Port: 3306, ProcessState: "Running"}}, nodes)
+				return err
+			},
+			expectedCalls: []string{"list-nodes --json --yes"},
+		},
+		{
+			name: "list nodes is shared within the inventory ttl",
+			opts: Options{Path: memsqlctl, InventoryTTL: time.Minute},
+			run: func(t *testing.T, c *CLI) error {
+				for i := 0; i < 3; i++ {
+					if _, err := c.ListNodes(context.Background()); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			expectedCalls: []string{"list-nodes --json --yes"},
+		},
+		{
+			name: "query",
+			opts: Options{Path: memsqlctl},
+			run: func(t *testing.T, c *CLI) error {
+				rows := make([]struct {
+					Value string `json:"VALUE"`
+				}, 0)
+				err := c.Query(context.Background(), "ABC", "SELECT 42 AS VALUE", &rows)
+				assert.Len(t, rows, 1)
+				assert.Equal(t, "42", rows[0].Value)
+				return err
+			},
+			expectedCalls: []string{"query --memsql-id ABC --sql SELECT 42 AS VALUE --json"},
+		},
+		{
+			name: "prefix",
+			opts: Options{Path: memsqlctl, Prefix: []string{prefix}},
+			run: func(t *testing.T, c *CLI) error {
+				_, err := c.ListNodes(context.Background())
+				return err
+			},
+			expectedCalls: []string{"prefix", "list-nodes --json --yes"},
+		},
+		{
+			name: "missing binary",
+			opts: Options{Path: filepath.Join(dir, "missing")},
+			run: func(t *testing.T, c *CLI) error {
+				assert.Error(t, c.Available())
+				_, err := c.ListNodes(context.Background())
+				return err
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(calls)
+
+			err := tc.run(t, NewCLI(tc.opts))
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			b, _ := os.ReadFile(calls)
+			got := strings.Split(strings.TrimSpace(string(b)), "\n")
+			if len(b) == 0 {
+				got = nil
+			}
+			assert.Equal(t, tc.expectedCalls, got)
+		})
+	}
+}
+
+func TestCLITimeoutKillsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "child")
+
+	// a child which would outlive memsqlctl if only memsqlctl was killed
+	memsqlctl := writeScript(t, dir, "memsqlctl", `
+sleep 60 &
+echo $! > `+pidFile+`
+wait
+`)
+
+	c := NewCLI(Options{Path: memsqlctl, Timeout: 200 * time.Millisecond})
+	start := time.Now()
+	_, err := c.ListNodes(context.Background())
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := strings.TrimSpace(string(b))
+	assert.Eventually(t, func() bool {
+		// the child is gone, or a zombie waiting for init
+		status, err := os.ReadFile("/proc/" + pid + "/stat")
+		return err != nil || strings.Contains(string(status), ") Z ")
+	}, 2*time.Second, 10*time.Millisecond)
+}
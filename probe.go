@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"singlestore_exporter/collector"
+	"singlestore_exporter/config"
+	"singlestore_exporter/log"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var errTooManyTargets = errors.New("too many probe targets in use, see probe.max_targets")
+
+// probePools keeps one connection pool per target and auth module,
+// so that probing a cluster does not reconnect on every scrape.
+// The targets come from the URL, so the pools are bounded by maxTargets and closed when idle.
+type probePools struct {
+	opts collector.DBPoolOptions
+	// tlsConfigName is the TLS config registered with the mysql driver, empty without TLS
+	tlsConfigName string
+	maxTargets    int
+	idleTimeout   time.Duration
+
+	mu    sync.Mutex
+	pools map[string]*probePool
+}
+
+type probePool struct {
+	pool *collector.DBPool
+	// refs counts the probes using the pool, which is only closed when unused
+	refs     int
+	lastUsed time.Time
+}
+
+func newProbePools(opts collector.DBPoolOptions, tlsConfigName string, probe config.ProbeConfig) *probePools {
+	return &probePools{
+		opts:          opts,
+		tlsConfigName: tlsConfigName,
+		maxTargets:    probe.MaxTargets,
+		idleTimeout:   probe.IdleTimeout,
+		pools:         make(map[string]*probePool),
+	}
+}
+
+// acquire returns the pool of target, which is kept open until release is called.
+// Pools idle for longer than idleTimeout are closed, and the least recently used one makes room
+// for a new target when maxTargets are open. errTooManyTargets is returned when every pool is in use.
+func (p *probePools) acquire(target string, authModule string, module config.AuthModule) (*collector.DBPool, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	key := authModule + "@" + target
+	var oldest string
+	for k, entry := range p.pools {
+		if k == key || entry.refs > 0 {
+			continue
+		}
+		if now.Sub(entry.lastUsed) > p.idleTimeout {
+			p.closePool(k)
+			continue
+		}
+		if oldest == "" || entry.lastUsed.Before(p.pools[oldest].lastUsed) {
+			oldest = k
+		}
+	}
+
+	entry, exists := p.pools[key]
+	if !exists {
+		if len(p.pools) >= p.maxTargets {
+			if oldest == "" {
+				return nil, nil, errTooManyTargets
+			}
+			p.closePool(oldest)
+		}
+
+		dsnConfig := mysql.NewConfig()
+		dsnConfig.User = module.User
+		dsnConfig.Passwd = module.Password
+		dsnConfig.Net = "tcp"
+		dsnConfig.Addr = target
+		dsnConfig.DBName = "information_schema"
+		dsnConfig.ParseTime = true
+		useDBTLS(dsnConfig, p.tlsConfigName)
+
+		entry = &probePool{pool: collector.NewDBPool(dsnConfig, p.opts)}
+		p.pools[key] = entry
+	}
+
+	entry.refs++
+	entry.lastUsed = now
+	release := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		entry.refs--
+		entry.lastUsed = time.Now()
+	}
+	return entry.pool, release, nil
+}
+
+// closePool closes the pool of key, which must not be in use. p.mu must be held.
+func (p *probePools) closePool(key string) {
+	if err := p.pools[key].pool.Close(); err != nil {
+		log.ErrorLogger.Errorf("failed to close db: err=%v", err)
+	}
+	delete(p.pools, key)
+}
+
+func (p *probePools) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key := range p.pools {
+		p.closePool(key)
+	}
+}
+
+func newProbeHandler(
+	version string,
+	reloader *reloader,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := reloader.acquire()
+		defer s.release()
+
+		// node-local collectors would report the host of the exporter, not the probed cluster
+		probeRegistrations := selectRegistrations(s.probeRegistrations, r)
+
+		params := r.URL.Query()
+		target := params.Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		authModule := params.Get("auth_module")
+		module, exists := s.cfg.AuthModules[authModule]
+		if !exists {
+			http.Error(w, "auth_module is unknown: "+authModule, http.StatusBadRequest)
+			return
+		}
+
+		pool, release, err := s.probePools.acquire(target, authModule, module)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+
+		ctx, cancel := scrapeContext(r, s.cfg.Scrape.TimeoutOffset)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		metrics, result, ok := s.scrapes.scrape(
+			ctx,
+			scrapeKey("probe:"+authModule+"@"+target, probeRegistrations),
+			// the scrape may be shared with concurrent requests, and must not end with this one
+			func(scrapeCtx context.Context) prometheus.Collector {
+				return collector.New(
+					scrapeCtx,
+					version,
+					pool,
+					probeRegistrations,
+				)
+			},
+		)
+		if !ok {
+			http.Error(w, "timed out waiting for a concurrent scrape", http.StatusServiceUnavailable)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(metricsCollector{metrics, result})
+
+		log.ErrorLogger.Debugf("probing target: target=%s auth_module=%s", target, authModule)
+
+		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"singlestore_exporter/collector"
+	"singlestore_exporter/config"
+	"singlestore_exporter/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.InitLoggers("", "error", ""); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestProbeReloader(probe config.ProbeConfig) *reloader {
+	cfg := &config.Config{
+		Probe:       probe,
+		AuthModules: map[string]config.AuthModule{"cluster_a": {User: "exporter"}},
+	}
+	r := &reloader{}
+	r.current.Store(&state{
+		cfg:        cfg,
+		probePools: newProbePools(collector.DBPoolOptions{}, "", probe),
+		scrapes:    newScrapeGroup(0),
+	})
+	return r
+}
+
+func TestProbeHandler(t *testing.T) {
+	tt := []struct {
+		name         string
+		query        string
+		expectedCode int
+	}{
+		{
+			name:         "missing target",
+			query:        "auth_module=cluster_a",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown auth module",
+			query:        "target=127.0.0.1:1&auth_module=cluster_b",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "probe",
+			query:        "target=127.0.0.1:1&auth_module=cluster_a",
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestProbeReloader(config.ProbeConfig{MaxTargets: 10, IdleTimeout: time.Minute})
+			w := httptest.NewRecorder()
+			newProbeHandler("test", r)(w, httptest.NewRequest(http.MethodGet, "/probe?"+tc.query, nil))
+			assert.Equal(t, tc.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestProbeHandlerReusesPool(t *testing.T) {
+	r := newTestProbeReloader(config.ProbeConfig{MaxTargets: 10, IdleTimeout: time.Minute})
+	handler := newProbeHandler("test", r)
+	pools := r.state().probePools
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/probe?target=127.0.0.1:1&auth_module=cluster_a", nil))
+	assert.Len(t, pools.pools, 1)
+	first := pools.pools["cluster_a@127.0.0.1:1"].pool
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/probe?target=127.0.0.1:1&auth_module=cluster_a", nil))
+	assert.Len(t, pools.pools, 1)
+	assert.Same(t, first, pools.pools["cluster_a@127.0.0.1:1"].pool)
+	assert.Equal(t, 0, pools.pools["cluster_a@127.0.0.1:1"].refs)
+}
+
+func TestProbePoolsEviction(t *testing.T) {
+	module := config.AuthModule{User: "exporter"}
+	pools := newProbePools(collector.DBPoolOptions{}, "", config.ProbeConfig{MaxTargets: 2, IdleTimeout: time.Minute})
+
+	_, releaseA, err := pools.acquire("a:3306", "m", module)
+	assert.NoError(t, err)
+	_, releaseB, err := pools.acquire("b:3306", "m", module)
+	assert.NoError(t, err)
+
+	// every pool is in use
+	_, _, err = pools.acquire("c:3306", "m", module)
+	assert.ErrorIs(t, err, errTooManyTargets)
+
+	// the least recently used idle pool makes room
+	releaseB()
+	releaseA()
+	_, releaseC, err := pools.acquire("c:3306", "m", module)
+	assert.NoError(t, err)
+	releaseC()
+	assert.Len(t, pools.pools, 2)
+	assert.NotContains(t, pools.pools, "m@b:3306")
+
+	// idle pools are closed after the idle timeout
+	pools.pools["m@a:3306"].lastUsed = time.Now().Add(-time.Hour)
+	_, releaseC, err = pools.acquire("c:3306", "m", module)
+	assert.NoError(t, err)
+	releaseC()
+	assert.Len(t, pools.pools, 1)
+	assert.Contains(t, pools.pools, "m@c:3306")
+}
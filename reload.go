@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"singlestore_exporter/collector"
+	"singlestore_exporter/config"
+	"singlestore_exporter/log"
+	"singlestore_exporter/memsqlctl"
+	"singlestore_exporter/web"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "singlestore",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful",
+	})
+
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "singlestore",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload",
+	})
+)
+
+// state is everything built from one version of the config.
+// It is replaced as a whole on reload, so a scrape never sees a half-applied config.
+type state struct {
+	cfg *config.Config
+	// dsn tells whether the pool can be kept on reload. It holds the password and must not be logged.
+	dsn  string
+	pool *collector.DBPool
+	// tlsConfigName is the TLS config registered with the mysql driver, released when the pools are closed
+	tlsConfigName string
+	// memsqlctl is shared by the node-local collectors
+	memsqlctl memsqlctl.Client
+
+	// registrations are scraped by /metrics, with background collectors served from their cache
+	registrations []collector.Registration
+	// probeRegistrations are scraped by /probe. Background collectors run inline,
+	// because their cache holds the results of the local cluster.
+	probeRegistrations []collector.Registration
+	probePools         *probePools
+	// scrapes coalesces concurrent scrapes of /metrics and /probe
+	scrapes *scrapeGroup
+
+	// stopBackground cancels the background collectors and waits for them, reaping their child processes
+	stopBackground func()
+
+	// users counts the requests using the connection pools, which are closed when the state is retired
+	// and the last of them is done, so that in-flight scrapes are not cut off by a reload
+	usersMu  sync.Mutex
+	users    int
+	retired  bool
+	keepPool *collector.DBPool
+}
+
+type reloader struct {
+	// ctx is cancelled on shutdown, stopping every background collector
+	ctx        context.Context
+	configFile string
+	defaults   func() *config.Config
+	// webServer re-reads the web config file on every reload
+	webServer *web.Server
+	// states keeps the counters of the stateful collectors across reloads
+	states *collector.ScraperStates
+
+	mu      sync.Mutex // serializes reloads
+	current atomic.Pointer[state]
+}
+
+func newReloader(ctx context.Context, configFile string, defaults func() *config.Config, webServer *web.Server) *reloader {
+	return &reloader{
+		ctx:        ctx,
+		configFile: configFile,
+		defaults:   defaults,
+		webServer:  webServer,
+		states:     collector.NewScraperStates(),
+	}
+}
+
+func (r *reloader) state() *state {
+	return r.current.Load()
+}
+
+// Reload reads the config file and applies it. On error the running config is kept.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.reload()
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	return nil
+}
+
+func (r *reloader) reload() error {
+	cfg := r.defaults()
+	if err := config.LoadFile(r.configFile, cfg); err != nil {
+		return err
+	}
+
+	memsqlctlClient := memsqlctl.NewCLI(memsqlctl.Options{
+		Path:         cfg.Memsqlctl.Path,
+		Prefix:       cfg.Memsqlctl.Prefix,
+		Timeout:      cfg.Memsqlctl.Timeout,
+		InventoryTTL: cfg.Memsqlctl.InventoryTTL,
+	})
+
+	mysqlConfig, err := cfg.DSN.MySQLConfig()
+	if err != nil {
+		return err
+	}
+
+	registrations, err := buildRegistrations(cfg, memsqlctlClient, mysqlConfig != nil, r.states)
+	if err != nil {
+		return err
+	}
+	dbTLS, err := loadDBTLS(cfg.DB.TLS)
+	if err != nil {
+		return err
+	}
+	tlsConfigName := dbTLS.Name()
+	if mysqlConfig != nil {
+		useDBTLS(mysqlConfig, tlsConfigName)
+	}
+
+	old := r.current.Load()
+	if old != nil && old.cfg.Web.ListenAddress != cfg.Web.ListenAddress {
+		log.ErrorLogger.Warnf("web.listen_address is only applied on restart: current=%s new=%s", old.cfg.Web.ListenAddress, cfg.Web.ListenAddress)
+	}
+
+	// every file is checked before anything is applied, so that a failed reload keeps the running config as a whole
+	if old != nil {
+		commitWeb, err := r.webServer.Prepare()
+		if err != nil {
+			return err
+		}
+		if err := log.ReloadLoggers(cfg.Log.Path, cfg.Log.Level, cfg.SlowQuery.LogPath); err != nil {
+			return err
+		}
+		commitWeb()
+	}
+
+	// registered once nothing can fail anymore, the state releases it when its pools are closed
+	if err := dbTLS.register(); err != nil {
+		return err
+	}
+
+	poolOptions := collector.DBPoolOptions{
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxLifetime: cfg.DB.ConnMaxLifetime,
+	}
+
+	s := &state{
+		cfg:           cfg,
+		tlsConfigName: tlsConfigName,
+		memsqlctl:     memsqlctlClient,
+		probePools:    newProbePools(poolOptions, tlsConfigName, cfg.Probe),
+		scrapes:       newScrapeGroup(cfg.Scrape.MinInterval),
+	}
+	if mysqlConfig != nil {
+		s.dsn = mysqlConfig.FormatDSN()
+	}
+
+	// keep the connection pool when the DSN did not change, to avoid reconnecting
+	if old != nil && old.dsn == s.dsn && old.cfg.DSN == cfg.DSN && old.cfg.DB == cfg.DB {
+		s.pool = old.pool
+	} else if mysqlConfig != nil {
+		s.pool = collector.NewDBPool(mysqlConfig, poolOptions)
+		log.ErrorLogger.Infof("connecting to the aggregator: dsn=%s", collector.RedactDSN(mysqlConfig))
+	}
+
+	s.registrations, s.probeRegistrations, s.stopBackground = startBackground(r.ctx, cfg, registrations, s.pool)
+
+	r.current.Store(s)
+	dbTLS.publishExpiry()
+
+	if old != nil {
+		old.retire(s.pool)
+	}
+
+	log.ErrorLogger.Infof("config loaded: file=%s", r.configFile)
+	return nil
+}
+
+// Close stops the background collectors and closes every connection pool. It is called on shutdown.
+func (r *reloader) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.current.Load(); s != nil {
+		s.retire(nil)
+	}
+}
+
+// acquire returns the current state, whose connection pools are kept open until release is called.
+func (r *reloader) acquire() *state {
+	for {
+		if s := r.current.Load(); s.acquire() {
+			return s
+		}
+		// retired by a reload in the meantime, the next state is already stored
+	}
+}
+
+func (s *state) acquire() bool {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	if s.retired {
+		return false
+	}
+	s.users++
+	return true
+}
+
+func (s *state) release() {
+	s.usersMu.Lock()
+	s.users--
+	unused := s.retired && s.users == 0
+	s.usersMu.Unlock()
+
+	if unused {
+		s.closePools()
+	}
+}
+
+// retire stops the background collectors, and closes the connection pools once the requests
+// using them are done, except keepPool which is reused by the next state.
+func (s *state) retire(keepPool *collector.DBPool) {
+	s.stopBackground()
+
+	s.usersMu.Lock()
+	s.retired = true
+	s.keepPool = keepPool
+	unused := s.users == 0
+	s.usersMu.Unlock()
+
+	if unused {
+		s.closePools()
+	}
+}
+
+func (s *state) closePools() {
+	s.probePools.close()
+	if s.pool != nil && s.pool != s.keepPool {
+		if err := s.pool.Close(); err != nil {
+			log.ErrorLogger.Errorf("failed to close db: err=%v", err)
+		}
+	}
+	releaseDBTLS(s.tlsConfigName)
+}
+
+func buildRegistrations(cfg *config.Config, memsqlctlClient memsqlctl.Client, hasDSN bool, states *collector.ScraperStates) ([]collector.Registration, error) {
+	statusAllowlist, err := compileAllowlist(cfg.GlobalStatus.Allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("global_status.allowlist is invalid: %v", err)
+	}
+	variablesInfoAllowlist, err := compileAllowlist(cfg.GlobalVariables.InfoAllowlist)
+	if err != nil {
+		return nil, fmt.Errorf("global_variables.info_allowlist is invalid: %v", err)
+	}
+
+	nodesSource := cfg.Nodes.Source
+	if nodesSource == "auto" {
+		// decided on every reload, e.g. after memsqlctl was installed
+		nodesSource = collector.NodesSourceMemsqlctl
+		if err := memsqlctlClient.Available(); err != nil {
+			nodesSource = collector.NodesSourceSQL
+		}
+		log.ErrorLogger.Infof("node state source: source=%s", nodesSource)
+	}
+
+	memorySource := cfg.Memory.Source
+	if memorySource == "auto" {
+		// leaf hosts have no DSN, but memsqlctl can query the nodes of the host
+		memorySource = collector.MemorySourceSQL
+		if !hasDSN {
+			memorySource = collector.MemorySourceMemsqlctl
+		}
+	}
+
+	scraperOptions := &collector.ScraperOptions{
+		Memsqlctl:          memsqlctlClient,
+		NodesSource:        nodesSource,
+		MemorySource:       memorySource,
+		SlowQueryThreshold: cfg.SlowQuery.Threshold,
+		SlowQueryFilter: collector.ProcessFilter{
+			Hosts:         cfg.SlowQuery.ExceptionHosts,
+			InfoPatterns:  cfg.SlowQuery.ExceptionInfoPatterns,
+			InfoRegexps:   cfg.SlowQuery.InfoRegexps(),
+			Users:         cfg.SlowQuery.ExceptionUsers,
+			DBs:           cfg.SlowQuery.ExceptionDBs,
+			Commands:      cfg.SlowQuery.ExceptionCommands,
+			ResourcePools: cfg.SlowQuery.ExceptionResourcePools,
+		},
+		DataDiskUsageParallelism:     cfg.DataDiskUsage.Parallelism,
+		DataDiskUsageCommandTimeout:  cfg.DataDiskUsage.CommandTimeout,
+		ActivitiesTopQueries:         cfg.Activities.TopQueries,
+		PlanCacheTopPlans:            cfg.PlanCache.TopPlans,
+		PlanCacheRanking:             cfg.PlanCache.Ranking,
+		GlobalStatusAllowlist:        statusAllowlist,
+		GlobalVariablesInfoAllowlist: variablesInfoAllowlist,
+		States:                       states,
+	}
+
+	all := collector.Registry(scraperOptions)
+	known := make(map[string]bool, len(all))
+	for _, registration := range all {
+		known[registration.Scraper.Name()] = true
+	}
+	for name := range cfg.Collectors {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown collector in config: collector=%s", name)
+		}
+	}
+
+	registrations := make([]collector.Registration, 0)
+	for _, registration := range all {
+		collectorConfig := cfg.Collectors[registration.Scraper.Name()]
+		if collectorConfig.Enabled {
+			registration.Timeout = collectorConfig.Timeout
+			registrations = append(registrations, registration)
+		}
+	}
+	return registrations, nil
+}
+
+// compileAllowlist compiles regexps which have to match a whole name.
+func compileAllowlist(exprs []string) ([]*regexp.Regexp, error) {
+	allowlist := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, err
+		}
+		allowlist = append(allowlist, re)
+	}
+	return allowlist, nil
+}
+
+// startBackground starts the collectors configured with a background_interval,
+// and replaces them in the returned /metrics registrations with scrapers serving their cache.
+func startBackground(
+	ctx context.Context,
+	cfg *config.Config,
+	registrations []collector.Registration,
+	pool *collector.DBPool,
+) ([]collector.Registration, []collector.Registration, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
+	metricsRegistrations := make([]collector.Registration, 0, len(registrations))
+	probeRegistrations := make([]collector.Registration, 0, len(registrations))
+	for _, registration := range registrations {
+		if !registration.NodeLocal {
+			probeRegistrations = append(probeRegistrations, registration)
+		}
+
+		interval := cfg.Collectors[registration.Scraper.Name()].BackgroundInterval
+		// like the exporter, collectors requiring a DSN are not run without one
+		if interval <= 0 || registration.RequiresDSN && pool == nil {
+			metricsRegistrations = append(metricsRegistrations, registration)
+			continue
+		}
+
+		scraper := collector.NewBackgroundScraper(registration, interval, pool)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scraper.Run(ctx)
+		}()
+
+		// serving the cache is instant, the timeout applies to the background runs
+		registration.Scraper = scraper
+		registration.Timeout = 0
+		metricsRegistrations = append(metricsRegistrations, registration)
+	}
+
+	stop := func() {
+		cancel()
+		wg.Wait()
+	}
+	return metricsRegistrations, probeRegistrations, stop
+}
+
+// poolCollector exports the statistics of the connection pool of the current config.
+type poolCollector struct {
+	reloader *reloader
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector, the pool may come and go with reloads
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	if s := c.reloader.state(); s != nil && s.pool != nil {
+		s.pool.Collect(ch)
+	}
+}
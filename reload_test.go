@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"singlestore_exporter/collector"
+	"singlestore_exporter/config"
+	"singlestore_exporter/web"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateRetire(t *testing.T) {
+	s := &state{
+		probePools:     newProbePools(collector.DBPoolOptions{}, "", config.ProbeConfig{MaxTargets: 10, IdleTimeout: time.Minute}),
+		stopBackground: func() {},
+	}
+	_, releasePool, err := s.probePools.acquire("a:3306", "m", config.AuthModule{User: "exporter"})
+	assert.NoError(t, err)
+	releasePool()
+
+	// an in-flight scrape keeps the pools open after a reload
+	assert.True(t, s.acquire())
+	s.retire(nil)
+	assert.Len(t, s.probePools.pools, 1)
+
+	// requests arriving after the reload use the next state
+	assert.False(t, s.acquire())
+
+	s.release()
+	assert.Empty(t, s.probePools.pools)
+}
+
+func TestStartBackground(t *testing.T) {
+	cfg := &config.Config{
+		Collectors: config.Collectors{
+			"nodes":      {Enabled: true, BackgroundInterval: time.Hour},
+			"slow_query": {Enabled: true, BackgroundInterval: time.Hour},
+		},
+	}
+	registrations := []collector.Registration{
+		{Scraper: namedScraper("nodes"), NodeLocal: true},
+		{Scraper: namedScraper("slow_query"), RequiresDSN: true},
+	}
+
+	metricsRegistrations, probeRegistrations, stop := startBackground(context.Background(), cfg, registrations, nil)
+	defer stop()
+
+	// without a DSN, the collector requiring one is left to the exporter, which skips it
+	_, isBackground := metricsRegistrations[0].Scraper.(*collector.BackgroundScraper)
+	assert.True(t, isBackground)
+	assert.Equal(t, namedScraper("slow_query"), metricsRegistrations[1].Scraper)
+	assert.Equal(t, []collector.Registration{registrations[1]}, probeRegistrations)
+}
+
+func TestReloadKeepsScraperStates(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(configFile, []byte("collectors:\n  plancache:\n    enabled: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defaults := func() *config.Config {
+		return &config.Config{
+			Web:           config.WebConfig{ListenAddress: "127.0.0.1:9105"},
+			Log:           config.LogConfig{Level: "error"},
+			SlowQuery:     config.SlowQueryConfig{Threshold: 10},
+			Nodes:         config.NodesConfig{Source: "memsqlctl"},
+			DataDiskUsage: config.DataDiskUsageConfig{Parallelism: 1},
+			Activities:    config.ActivitiesConfig{TopQueries: 20},
+			PlanCache:     config.PlanCacheConfig{TopPlans: 20, Ranking: "execution_time"},
+			Memory:        config.MemoryConfig{Source: "auto"},
+			Memsqlctl:     config.MemsqlctlConfig{Path: "/usr/bin/memsqlctl"},
+			Probe:         config.ProbeConfig{MaxTargets: 1, IdleTimeout: time.Minute},
+		}
+	}
+	webServer, err := web.NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReloader(context.Background(), configFile, defaults, webServer)
+	defer r.Close()
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	// executions of plan 1 since the previous scrape, which may have run before a reload
+	scrapeExecutions := func(commits int) float64 {
+		mock.ExpectQuery("FROM information_schema.PLANCACHE").WillReturnRows(sqlmock.NewRows([]string{
+			"PLAN_ID", "DATABASE_NAME", "QUERY_TEXT", "COMMITS", "ROLLBACKS", "ROWCOUNT", "EXECUTION_TIME", "AVERAGE_MEMORY_USE",
+		}).AddRow(1, "db", "SELECT ?", commits, 0, 0, commits*100, 0))
+
+		s := r.state()
+		ch := make(chan prometheus.Metric, 20)
+		for _, registration := range s.registrations {
+			if registration.Scraper.Name() == "plancache" {
+				assert.NoError(t, registration.Scraper.Scrape(context.Background(), db, ch))
+			}
+		}
+		close(ch)
+
+		for metric := range ch {
+			m := &dto.Metric{}
+			assert.NoError(t, metric.Write(m))
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "plan_id" && label.GetValue() == "1" && strings.Contains(metric.Desc().String(), `"singlestore_plancache_executions_total"`) {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+		return -1
+	}
+
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0.0, scrapeExecutions(10))
+
+	// the counters go on from the scrape before the reload
+	assert.NoError(t, r.Reload())
+	assert.Equal(t, 5.0, scrapeExecutions(15))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,101 @@
+package web
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the web config file, in the format of the Prometheus exporter-toolkit.
+type Config struct {
+	// TLSServerConfig serves HTTPS when set
+	TLSServerConfig *TLSConfig `yaml:"tls_server_config"`
+	// BasicAuthUsers maps user names to bcrypt hashes of their passwords.
+	// Every request must authenticate when it is not empty.
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientAuthType is the name of a tls.ClientAuthType, e.g. RequireAndVerifyClientCert
+	ClientAuthType string `yaml:"client_auth_type"`
+	// ClientCAFile verifies client certificates
+	ClientCAFile string `yaml:"client_ca_file"`
+	// MinVersion is one of TLS10, TLS11, TLS12 and TLS13. It defaults to TLS12.
+	MinVersion string `yaml:"min_version"`
+}
+
+var (
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"":                           tls.NoClientCert,
+		"NoClientCert":               tls.NoClientCert,
+		"RequestClientCert":          tls.RequestClientCert,
+		"RequireAnyClientCert":       tls.RequireAnyClientCert,
+		"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+		"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+	}
+
+	tlsVersions = map[string]uint16{
+		"":      tls.VersionTLS12,
+		"TLS10": tls.VersionTLS10,
+		"TLS11": tls.VersionTLS11,
+		"TLS12": tls.VersionTLS12,
+		"TLS13": tls.VersionTLS13,
+	}
+)
+
+// LoadConfig reads and validates the web config file at path.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web config file: path=%s err=%v", path, err)
+	}
+
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse web config file: path=%s err=%v", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid web config: path=%s err=%v", path, err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	for user, hash := range c.BasicAuthUsers {
+		if user == "" {
+			return fmt.Errorf("basic_auth_users has an empty user name")
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("basic_auth_users.%s is not a bcrypt hash: %v", user, err)
+		}
+	}
+
+	t := c.TLSServerConfig
+	if t == nil {
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return fmt.Errorf("tls_server_config.cert_file and tls_server_config.key_file are required")
+	}
+	clientAuth, ok := clientAuthTypes[t.ClientAuthType]
+	if !ok {
+		return fmt.Errorf("tls_server_config.client_auth_type is unknown: %s", t.ClientAuthType)
+	}
+	if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) && t.ClientCAFile == "" {
+		return fmt.Errorf("tls_server_config.client_ca_file is required by client_auth_type %s", t.ClientAuthType)
+	}
+	if _, ok := tlsVersions[t.MinVersion]; !ok {
+		return fmt.Errorf("tls_server_config.min_version is unknown: %s", t.MinVersion)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"singlestore_exporter/log"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxAuthCache bounds the number of cached credentials
+	maxAuthCache = 1024
+
+	// dummyHash is compared against the password of unknown users,
+	// so that they take as long to be rejected as wrong passwords.
+	dummyHash = "$2a$10$mXiD7W1yb6LivUawtFMu1uPL0CxUQxS4XSQ2tx2vhhkIXxgTjGItW"
+)
+
+// Server applies the web config file to an http.Server.
+// The file is re-read by Reload, and the certificates whenever they change on disk.
+type Server struct {
+	path string
+
+	mu     sync.Mutex
+	config *Config
+	// authCache holds the digests of credentials which passed bcrypt, which is slow on purpose
+	authCache map[[sha256.Size]byte]bool
+
+	cert       *tls.Certificate
+	certStamps [2]fileStamp
+	clientCAs  *x509.CertPool
+	caStamp    fileStamp
+}
+
+// fileStamp tells whether a file changed since it was loaded
+type fileStamp struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func stat(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{path: path, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// NewServer loads the web config file at path. An empty path serves plain HTTP without authentication.
+func NewServer(path string) (*Server, error) {
+	s := &Server{
+		path:      path,
+		config:    &Config{},
+		authCache: make(map[[sha256.Size]byte]bool),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads the web config file. On error the running config is kept.
+// TLS can only be turned on or off on restart, since the listener is created at startup.
+func (s *Server) Reload() error {
+	commit, err := s.Prepare()
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+// Prepare re-reads the web config file and its certificates like Reload, but only applies them
+// when commit is called, so that a config reload can check every file before it applies any.
+func (s *Server) Prepare() (commit func(), err error) {
+	if s.path == "" {
+		return func() {}, nil
+	}
+
+	cfg, err := LoadConfig(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	useTLS := s.config.TLSServerConfig != nil
+	if useTLS != (cfg.TLSServerConfig != nil) {
+		return nil, fmt.Errorf("tls_server_config is only turned on or off on restart: path=%s", s.path)
+	}
+	var certs *certificates
+	if cfg.TLSServerConfig != nil {
+		if certs, err = s.loadCertificates(cfg.TLSServerConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if certs != nil {
+			s.setCertificates(certs)
+		}
+		s.config = cfg
+		s.authCache = make(map[[sha256.Size]byte]bool)
+	}, nil
+}
+
+func (s *Server) apply(cfg *Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cfg.TLSServerConfig != nil {
+		if err := s.refreshCertificates(cfg.TLSServerConfig); err != nil {
+			return err
+		}
+	}
+	s.config = cfg
+	s.authCache = make(map[[sha256.Size]byte]bool)
+	return nil
+}
+
+// certificates are the files of a TLSConfig as loaded, with the stamps telling whether they changed since
+type certificates struct {
+	cert       *tls.Certificate
+	certStamps [2]fileStamp
+	clientCAs  *x509.CertPool
+	caStamp    fileStamp
+}
+
+// refreshCertificates loads the certificate and the client CAs again if their files changed.
+// Nothing is replaced unless every file could be loaded, so a half-written rotation keeps the previous ones.
+func (s *Server) refreshCertificates(t *TLSConfig) error {
+	certs, err := s.loadCertificates(t)
+	if err != nil {
+		return err
+	}
+	s.setCertificates(certs)
+	return nil
+}
+
+// loadCertificates reads the files of t which changed since they were loaded, and reuses the others. s.mu must be held.
+func (s *Server) loadCertificates(t *TLSConfig) (*certificates, error) {
+	certStamp, err := stat(t.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: path=%s err=%v", t.CertFile, err)
+	}
+	keyStamp, err := stat(t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: path=%s err=%v", t.KeyFile, err)
+	}
+	var caStamp fileStamp
+	if t.ClientCAFile != "" {
+		if caStamp, err = stat(t.ClientCAFile); err != nil {
+			return nil, fmt.Errorf("failed to read client CA: path=%s err=%v", t.ClientCAFile, err)
+		}
+	}
+
+	cert := s.cert
+	if cert == nil || s.certStamps != [2]fileStamp{certStamp, keyStamp} {
+		loaded, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: cert_file=%s key_file=%s err=%v", t.CertFile, t.KeyFile, err)
+		}
+		cert = &loaded
+	}
+
+	clientCAs := s.clientCAs
+	if t.ClientCAFile == "" {
+		clientCAs = nil
+	} else if clientCAs == nil || s.caStamp != caStamp {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: path=%s err=%v", t.ClientCAFile, err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client CA: path=%s", t.ClientCAFile)
+		}
+	}
+
+	return &certificates{
+		cert:       cert,
+		certStamps: [2]fileStamp{certStamp, keyStamp},
+		clientCAs:  clientCAs,
+		caStamp:    caStamp,
+	}, nil
+}
+
+// setCertificates serves certs from now on. s.mu must be held.
+func (s *Server) setCertificates(certs *certificates) {
+	s.cert = certs.cert
+	s.certStamps = certs.certStamps
+	s.clientCAs = certs.clientCAs
+	s.caStamp = certs.caStamp
+}
+
+// getConfigForClient is called on every TLS handshake, picking up rotated certificates.
+func (s *Server) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.config.TLSServerConfig
+	if err := s.refreshCertificates(t); err != nil {
+		log.ErrorLogger.Errorf("failed to reload certificates, keeping the previous ones: err=%v", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{*s.cert},
+		MinVersion:   tlsVersions[t.MinVersion],
+		ClientAuth:   clientAuthTypes[t.ClientAuthType],
+		ClientCAs:    s.clientCAs,
+	}, nil
+}
+
+// Handler requires basic auth in front of next when users are configured.
+func (s *Server) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="singlestore_exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	s.mu.Lock()
+	users := s.config.BasicAuthUsers
+	s.mu.Unlock()
+
+	if len(users) == 0 {
+		return true
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, exists := users[user]
+	if !exists {
+		hash = dummyHash
+	}
+
+	// the hash is part of the digest, so a changed password is never served from the cache
+	digest := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + password))
+	s.mu.Lock()
+	cached := s.authCache[digest]
+	s.mu.Unlock()
+	if cached {
+		return true
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || !exists {
+		return false
+	}
+
+	s.mu.Lock()
+	if len(s.authCache) >= maxAuthCache {
+		s.authCache = make(map[[sha256.Size]byte]bool)
+	}
+	s.authCache[digest] = true
+	s.mu.Unlock()
+	return true
+}
+
+// ListenAndServe serves server with the TLS and basic auth settings of the web config file.
+func (s *Server) ListenAndServe(server *http.Server) error {
+	server.Handler = s.Handler(server.Handler)
+
+	s.mu.Lock()
+	useTLS := s.config.TLSServerConfig != nil
+	s.mu.Unlock()
+
+	if !useTLS {
+		return server.ListenAndServe()
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = &tls.Config{
+		GetConfigForClient: s.getConfigForClient,
+	}
+	return server.Serve(tls.NewListener(listener, server.TLSConfig))
+}
@@ -0,0 +1,221 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"singlestore_exporter/log"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.InitLoggers("", "error", ""); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeCertificate writes a self-signed certificate for commonName and its key
+func writeCertificate(t *testing.T, dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := writeFile(t, dir, "cert.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	keyFile := writeFile(t, dir, "key.pem", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+	return certFile, keyFile
+}
+
+func TestLoadConfig(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name        string
+		content     string
+		expectedErr bool
+	}{
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name:    "basic auth users",
+			content: "basic_auth_users:\n  prometheus: " + string(hash) + "\n",
+		},
+		{
+			name:        "password which is not hashed",
+			content:     "basic_auth_users:\n  prometheus: secret\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown keys are rejected",
+			content:     "tls_server_config:\n  cert: cert.pem\n",
+			expectedErr: true,
+		},
+		{
+			name:        "key file is required",
+			content:     "tls_server_config:\n  cert_file: cert.pem\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown min version",
+			content:     "tls_server_config:\n  cert_file: cert.pem\n  key_file: key.pem\n  min_version: TLS14\n",
+			expectedErr: true,
+		},
+		{
+			name:        "client certificates cannot be verified without a CA",
+			content:     "tls_server_config:\n  cert_file: cert.pem\n  key_file: key.pem\n  client_auth_type: RequireAndVerifyClientCert\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), "web.yml", tc.content)
+
+			_, err := LoadConfig(path)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, t.TempDir(), "web.yml", "basic_auth_users:\n  prometheus: "+string(hash)+"\n")
+
+	s, err := NewServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tt := []struct {
+		name         string
+		user         string
+		password     string
+		expectedCode int
+	}{
+		{name: "no credentials", expectedCode: http.StatusUnauthorized},
+		{name: "valid credentials", user: "prometheus", password: "secret", expectedCode: http.StatusOK},
+		{name: "valid credentials from the cache", user: "prometheus", password: "secret", expectedCode: http.StatusOK},
+		{name: "wrong password", user: "prometheus", password: "wrong", expectedCode: http.StatusUnauthorized},
+		{name: "unknown user", user: "grafana", password: "secret", expectedCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.user != "" {
+				r.SetBasicAuth(tc.user, tc.password)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tc.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestCertificateRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "before")
+	path := writeFile(t, dir, "web.yml", "tls_server_config:\n  cert_file: "+certFile+"\n  key_file: "+keyFile+"\n")
+
+	s, err := NewServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commonName := func() string {
+		cfg, err := s.getConfigForClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Subject.CommonName
+	}
+	assert.Equal(t, "before", commonName())
+
+	// a half-written rotation keeps the previous certificate
+	writeFile(t, dir, "key.pem", "")
+	assert.Equal(t, "before", commonName())
+
+	writeCertificate(t, dir, "after")
+	assert.Equal(t, "after", commonName())
+}
+
+func TestPrepare(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := writeFile(t, dir, "web.yml", "")
+
+	s, err := NewServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new users are only required once committed
+	writeFile(t, dir, "web.yml", "basic_auth_users:\n  prometheus: "+string(hash)+"\n")
+	commit, err := s.Prepare()
+	assert.NoError(t, err)
+	assert.True(t, s.authorized(httptest.NewRequest(http.MethodGet, "/metrics", nil)))
+	commit()
+	assert.False(t, s.authorized(httptest.NewRequest(http.MethodGet, "/metrics", nil)))
+
+	// an invalid file is rejected before anything is applied
+	writeFile(t, dir, "web.yml", "tls_server_config:\n  cert_file: missing.pem\n  key_file: missing.pem\n")
+	_, err = s.Prepare()
+	assert.Error(t, err)
+}